@@ -0,0 +1,314 @@
+// Package acl restricts which callers may do what with which leases.
+//
+// A [Provider] wraps any [lease.Provider],
+// checking each call against a list of [Rule]s
+// that map caller identities to the operations they may perform
+// on the leases whose names begin with given prefixes.
+//
+// The identity of a caller is carried in the context of each call (see [WithIdentity]).
+// The lease servers in github.com/bobg/lease/v2/grpcserver and github.com/bobg/lease/v2/httpserver
+// set it from the caller's credentials using an [Authenticator].
+package acl
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+)
+
+// ErrDenied is the error returned for calls that the rules do not permit.
+var ErrDenied = errors.New("permission denied")
+
+// Op is a set of operations on leases.
+type Op uint
+
+// The operations on leases.
+const (
+	Acquire Op = 1 << iota // Acquire, AcquireWait for a [lease.Waiter], and AcquireTTL for a [lease.TTLProvider]
+	Renew                  // Renew, Transfer for a [lease.Transferer], and RenewTTL for a [lease.TTLProvider]
+	Release                // Release
+	Inspect                // Inspect and List for a [lease.Inspector], and History for a [lease.Historian]
+	Break                  // Break for a [lease.Breaker]
+
+	All = Acquire | Renew | Release | Inspect | Break
+)
+
+func (op Op) String() string {
+	var names []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{{Acquire, "acquire"}, {Renew, "renew"}, {Release, "release"}, {Inspect, "inspect"}, {Break, "break"}} {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Rule permits callers with a given identity
+// to perform some operations
+// on leases whose names begin with a given prefix.
+type Rule struct {
+	// Identity is the identity of the callers to which the rule applies.
+	// The special value "*" matches every authenticated caller,
+	// and the empty string matches only unauthenticated ones.
+	Identity string
+
+	// Prefix is the lease-name prefix to which the rule applies.
+	// The empty string matches all leases.
+	Prefix string
+
+	// Ops is the set of operations the rule permits.
+	Ops Op
+}
+
+func (r Rule) matches(identity, name string) bool {
+	switch {
+	case r.Identity == "*" && identity == "":
+		return false
+	case r.Identity != "*" && r.Identity != identity:
+		return false
+	}
+	return strings.HasPrefix(name, r.Prefix)
+}
+
+// Allowed tells whether the given rules permit the caller with the given identity
+// to perform all of the operations in op on the lease with the given name.
+// Operations may be permitted by different rules.
+func Allowed(rules []Rule, identity, name string, op Op) bool {
+	var permitted Op
+	for _, r := range rules {
+		if r.matches(identity, name) {
+			permitted |= r.Ops
+		}
+	}
+	return op&^permitted == 0
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the given caller identity.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Identity returns the caller identity in the given context,
+// or the empty string if there is none.
+// See [WithIdentity].
+func Identity(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+	return identity
+}
+
+// Holder returns the holder identity (see [lease.WithHolder])
+// to record for a call whose request names the given holder.
+// If ctx carries a caller identity,
+// that is the holder,
+// and a request naming a different one fails with an error wrapping [ErrDenied].
+// Otherwise it is the requested holder.
+func Holder(ctx context.Context, requested string) (string, error) {
+	identity := Identity(ctx)
+	switch {
+	case identity == "":
+		return requested, nil
+	case requested != "" && requested != identity:
+		return "", errors.Wrapf(ErrDenied, "%s may not act as holder %s", identity, requested)
+	}
+	return identity, nil
+}
+
+// Provider is a lease.Provider that wraps another,
+// permitting only the calls allowed by its rules
+// for the caller identity in each call's context.
+// Other calls fail with [ErrDenied].
+//
+// Provider implements [lease.Waiter], [lease.Inspector], [lease.Historian], [lease.Breaker], [lease.Transferer], and [lease.TTLProvider]
+// by passing calls through to the wrapped provider.
+// If that does not implement the corresponding interface,
+// the call fails with [errors.ErrUnsupported].
+// The results of List and History are filtered,
+// omitting leases that the caller may not inspect.
+type Provider struct {
+	lease.Provider
+
+	rules []Rule
+}
+
+var (
+	_ Authorizer        = &Provider{}
+	_ lease.Provider    = &Provider{}
+	_ lease.Waiter      = &Provider{}
+	_ lease.Inspector   = &Provider{}
+	_ lease.Historian   = &Provider{}
+	_ lease.Breaker     = &Provider{}
+	_ lease.Transferer  = &Provider{}
+	_ lease.TTLProvider = &Provider{}
+)
+
+// New creates a new Provider wrapping p and permitting the calls allowed by the given rules.
+func New(p lease.Provider, rules ...Rule) *Provider {
+	return &Provider{Provider: p, rules: rules}
+}
+
+// Authorizer is implemented by a [lease.Provider] that restricts callers,
+// such as [Provider],
+// so that code handling lease information outside the provider
+// can apply the same restrictions.
+type Authorizer interface {
+	// Check returns nil if the caller identified in ctx (see [Identity])
+	// may perform op on the lease with the given name,
+	// and an error wrapping [ErrDenied] otherwise.
+	Check(ctx context.Context, name string, op Op) error
+}
+
+// Check returns nil if the rules permit the caller identified in ctx
+// to perform op on the lease with the given name,
+// and an error wrapping [ErrDenied] otherwise.
+func (p *Provider) Check(ctx context.Context, name string, op Op) error {
+	identity := Identity(ctx)
+	if Allowed(p.rules, identity, name, op) {
+		return nil
+	}
+	if identity == "" {
+		identity = "unauthenticated caller"
+	}
+	return errors.Wrapf(ErrDenied, "%s may not %s lease %s", identity, op, name)
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if err := p.Check(ctx, name, Acquire); err != nil {
+		return "", time.Time{}, err
+	}
+	return p.Provider.Acquire(ctx, name, exp)
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if err := p.Check(ctx, name, Renew); err != nil {
+		return time.Time{}, err
+	}
+	return p.Provider.Renew(ctx, name, secret, exp)
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	if err := p.Check(ctx, name, Release); err != nil {
+		return err
+	}
+	return p.Provider.Release(ctx, name, secret)
+}
+
+// AcquireWait implements [lease.Waiter].
+func (p *Provider) AcquireWait(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	w, ok := p.Provider.(lease.Waiter)
+	if !ok {
+		return "", time.Time{}, errors.Wrap(errors.ErrUnsupported, "provider cannot wait for leases")
+	}
+	if err := p.Check(ctx, name, Acquire); err != nil {
+		return "", time.Time{}, err
+	}
+	return w.AcquireWait(ctx, name, exp)
+}
+
+// AcquireTTL implements [lease.TTLProvider].
+func (p *Provider) AcquireTTL(ctx context.Context, name string, ttl time.Duration) (string, time.Time, error) {
+	tp, ok := p.Provider.(lease.TTLProvider)
+	if !ok {
+		return "", time.Time{}, errors.Wrap(errors.ErrUnsupported, "provider cannot compute expiration times")
+	}
+	if err := p.Check(ctx, name, Acquire); err != nil {
+		return "", time.Time{}, err
+	}
+	return tp.AcquireTTL(ctx, name, ttl)
+}
+
+// RenewTTL implements [lease.TTLProvider].
+func (p *Provider) RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error) {
+	tp, ok := p.Provider.(lease.TTLProvider)
+	if !ok {
+		return time.Time{}, errors.Wrap(errors.ErrUnsupported, "provider cannot compute expiration times")
+	}
+	if err := p.Check(ctx, name, Renew); err != nil {
+		return time.Time{}, err
+	}
+	return tp.RenewTTL(ctx, name, secret, ttl)
+}
+
+// Break implements [lease.Breaker].
+func (p *Provider) Break(ctx context.Context, name, reason string) error {
+	b, ok := p.Provider.(lease.Breaker)
+	if !ok {
+		return errors.Wrap(errors.ErrUnsupported, "provider cannot break leases")
+	}
+	if err := p.Check(ctx, name, Break); err != nil {
+		return err
+	}
+	return b.Break(ctx, name, reason)
+}
+
+// Transfer implements [lease.Transferer].
+func (p *Provider) Transfer(ctx context.Context, name, secret string, exp time.Time) (string, time.Time, error) {
+	t, ok := p.Provider.(lease.Transferer)
+	if !ok {
+		return "", time.Time{}, errors.Wrap(errors.ErrUnsupported, "provider cannot transfer leases")
+	}
+	if err := p.Check(ctx, name, Renew); err != nil {
+		return "", time.Time{}, err
+	}
+	return t.Transfer(ctx, name, secret, exp)
+}
+
+// Inspect implements [lease.Inspector].
+func (p *Provider) Inspect(ctx context.Context, name string) (lease.Info, bool, error) {
+	insp, ok := p.Provider.(lease.Inspector)
+	if !ok {
+		return lease.Info{}, false, errors.Wrap(errors.ErrUnsupported, "provider does not support inspection")
+	}
+	if err := p.Check(ctx, name, Inspect); err != nil {
+		return lease.Info{}, false, err
+	}
+	return insp.Inspect(ctx, name)
+}
+
+// List implements [lease.Inspector].
+// It omits the leases that the caller may not inspect.
+func (p *Provider) List(ctx context.Context, prefix string) ([]lease.Info, error) {
+	insp, ok := p.Provider.(lease.Inspector)
+	if !ok {
+		return nil, errors.Wrap(errors.ErrUnsupported, "provider does not support inspection")
+	}
+	infos, err := insp.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	identity := Identity(ctx)
+	return slices.DeleteFunc(infos, func(info lease.Info) bool {
+		return !Allowed(p.rules, identity, info.Name, Inspect)
+	}), nil
+}
+
+// History implements [lease.Historian].
+// It omits the events for leases that the caller may not inspect.
+func (p *Provider) History(ctx context.Context, hq lease.HistoryQuery) ([]lease.Event, error) {
+	h, ok := p.Provider.(lease.Historian)
+	if !ok {
+		return nil, errors.Wrap(errors.ErrUnsupported, "provider keeps no history")
+	}
+	if hq.Name != "" {
+		if err := p.Check(ctx, hq.Name, Inspect); err != nil {
+			return nil, err
+		}
+	}
+	events, err := h.History(ctx, hq)
+	if err != nil {
+		return nil, err
+	}
+	identity := Identity(ctx)
+	return slices.DeleteFunc(events, func(ev lease.Event) bool {
+		return !Allowed(p.rules, identity, ev.Name, Inspect)
+	}), nil
+}
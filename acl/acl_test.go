@@ -0,0 +1,133 @@
+package acl
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/mem"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(rules ...Rule) testutil.Factory {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New()
+		p.Clock = clock
+		return New(p, rules...), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	ctx := WithIdentity(context.Background(), "alice")
+	testutil.Provider(ctx, t, factory(Rule{Identity: "alice", Ops: All}))
+}
+
+func TestInspector(t *testing.T) {
+	ctx := WithIdentity(context.Background(), "alice")
+	testutil.Inspector(ctx, t, factory(Rule{Identity: "*", Ops: All}))
+}
+
+func TestAllowed(t *testing.T) {
+	rules := []Rule{
+		{Identity: "alice", Prefix: "a/", Ops: Acquire | Renew},
+		{Identity: "alice", Prefix: "a/", Ops: Release},
+		{Identity: "*", Ops: Inspect},
+		{Identity: "", Prefix: "public/", Ops: All},
+	}
+
+	cases := []struct {
+		identity, name string
+		op             Op
+		want           bool
+	}{
+		{"alice", "a/x", Acquire, true},
+		{"alice", "a/x", Acquire | Renew | Release | Inspect, true}, // combining rules
+		{"alice", "a/x", All, false},
+		{"alice", "b/x", Acquire, false},
+		{"alice", "b/x", Inspect, true},
+		{"bob", "a/x", Acquire, false},
+		{"bob", "a/x", Inspect, true},
+		{"", "a/x", Inspect, false},
+		{"", "public/x", Acquire, true},
+		{"bob", "public/x", Acquire, false},
+	}
+
+	for _, tc := range cases {
+		if got := Allowed(rules, tc.identity, tc.name, tc.op); got != tc.want {
+			t.Errorf("Allowed(%q, %q, %s) = %v, want %v", tc.identity, tc.name, tc.op, got, tc.want)
+		}
+	}
+}
+
+func TestDenied(t *testing.T) {
+	var (
+		ctx = WithIdentity(context.Background(), "bob")
+		m   = mem.New()
+		p   = New(m, Rule{Identity: "bob", Prefix: "bob/", Ops: Acquire})
+		exp = time.Now().Add(time.Minute)
+	)
+
+	if _, _, err := p.Acquire(ctx, "alice/x", exp); !errors.Is(err, ErrDenied) {
+		t.Errorf("acquiring alice/x: got error %v, want ErrDenied", err)
+	}
+
+	secret, _, err := p.Acquire(ctx, "bob/x", exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Release(ctx, "bob/x", secret); !errors.Is(err, ErrDenied) {
+		t.Errorf("releasing bob/x: got error %v, want ErrDenied", err)
+	}
+	if _, _, err := p.AcquireWait(ctx, "bob/y", exp); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("waiting for bob/y: got error %v, want ErrUnsupported", err)
+	}
+	if _, err := p.History(ctx, lease.HistoryQuery{Name: "bob/x"}); !errors.Is(err, ErrDenied) {
+		t.Errorf("getting history of bob/x: got error %v, want ErrDenied", err)
+	}
+}
+
+func TestAuthenticators(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		tokens = Tokens{"secret1": "alice", "secret2": "bob"}
+		cert   = &x509.Certificate{Subject: pkix.Name{CommonName: "carol"}}
+		auth   = Any{tokens, CommonName{}}
+	)
+
+	cases := []struct {
+		name    string
+		creds   Credentials
+		want    string
+		wantErr bool
+	}{
+		{"token", Credentials{Token: "secret2"}, "bob", false},
+		{"bad token", Credentials{Token: "secret3"}, "", true},
+		{"cert", Credentials{Certs: []*x509.Certificate{cert}}, "carol", false},
+		{"cert without name", Credentials{Certs: []*x509.Certificate{{}}}, "", true},
+		{"token and cert", Credentials{Token: "secret1", Certs: []*x509.Certificate{cert}}, "alice", false},
+		{"none", Credentials{}, "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := auth.Authenticate(ctx, tc.creds)
+			if tc.wantErr {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("got error %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got identity %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
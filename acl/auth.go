@@ -0,0 +1,92 @@
+package acl
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+
+	"github.com/bobg/errors"
+)
+
+// ErrUnauthenticated is the error returned by an [Authenticator]
+// for credentials that it does not accept.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Credentials are what a caller presents to a lease server to identify itself.
+type Credentials struct {
+	// Token is the caller's bearer token, if any.
+	Token string
+
+	// Certs is the caller's TLS client certificate chain, if any, leaf first.
+	// Servers set it only from chains they have verified.
+	Certs []*x509.Certificate
+}
+
+// Authenticator determines the identity of a caller from its credentials.
+//
+// Authenticate returns the empty string for a caller that presents no credentials it recognizes,
+// and an error wrapping [ErrUnauthenticated] for a caller that presents bad ones.
+type Authenticator interface {
+	Authenticate(context.Context, Credentials) (string, error)
+}
+
+// Tokens is an [Authenticator] mapping bearer tokens to identities.
+type Tokens map[string]string
+
+// Authenticate implements [Authenticator].
+// It compares the token with every known one in constant time,
+// so as not to reveal them through timing.
+func (t Tokens) Authenticate(_ context.Context, creds Credentials) (string, error) {
+	if creds.Token == "" {
+		return "", nil
+	}
+
+	var (
+		want     = sha256.Sum256([]byte(creds.Token))
+		identity string
+	)
+	for token, id := range t {
+		got := sha256.Sum256([]byte(token))
+		if subtle.ConstantTimeCompare(want[:], got[:]) == 1 {
+			identity = id
+		}
+	}
+	if identity == "" {
+		return "", ErrUnauthenticated
+	}
+	return identity, nil
+}
+
+// CommonName is an [Authenticator] identifying callers
+// by the subject common name of their TLS client certificate.
+// Client certificates must be verified by the server's TLS configuration
+// (e.g. with [crypto/tls.RequireAndVerifyClientCert]).
+type CommonName struct{}
+
+// Authenticate implements [Authenticator].
+func (CommonName) Authenticate(_ context.Context, creds Credentials) (string, error) {
+	if len(creds.Certs) == 0 {
+		return "", nil
+	}
+	if cn := creds.Certs[0].Subject.CommonName; cn != "" {
+		return cn, nil
+	}
+	return "", errors.Wrap(ErrUnauthenticated, "client certificate has no common name")
+}
+
+// Any is an [Authenticator] that tries each of a list of Authenticators in turn,
+// returning the first identity found,
+// or failing as soon as one of them fails.
+type Any []Authenticator
+
+// Authenticate implements [Authenticator].
+func (a Any) Authenticate(ctx context.Context, creds Credentials) (string, error) {
+	for _, auth := range a {
+		identity, err := auth.Authenticate(ctx, creds)
+		if err != nil || identity != "" {
+			return identity, err
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,263 @@
+// Package bolt implements [lease.Provider] in terms of a bbolt embedded key-value store.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bobg/errors"
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/internal/gc"
+	"github.com/bobg/lease/v2/internal/secrets"
+)
+
+// Provider is a lease.Provider implemented in terms of a bbolt database.
+//
+// Leases are stored in a dedicated bucket,
+// keyed by name,
+// and each operation on them is a single read-write transaction.
+// Since bbolt persists to a file,
+// leases survive restarts of the process.
+type Provider struct {
+	lease.Clock
+
+	db     *bbolt.DB
+	bucket []byte
+
+	gcConfig  gc.Config
+	collector gc.Collector // runs GC in the background
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new bbolt lease provider using the given database.
+// The bucket for leases is created if it does not already exist.
+func New(db *bbolt.DB, opts ...Option) (*Provider, error) {
+	p := &Provider{
+		Clock:    lease.DefaultClock{},
+		db:       db,
+		bucket:   []byte(DefaultBucket),
+		gcConfig: gc.Config{Interval: DefaultGCInterval},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(p.bucket)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating bucket %s", p.bucket)
+	}
+
+	// The garbage collector runs until Close is called.
+	p.collector.Start(context.Background(), p.Clock, p.gcConfig, p.GC)
+
+	return p, nil
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// DefaultBucket is the name of the bucket in which leases are stored
+// unless overridden with [WithBucket].
+const DefaultBucket = "leases"
+
+// WithBucket is an [Option] that sets the name of the bucket in which leases are stored.
+func WithBucket(name string) Option {
+	return func(p *Provider) {
+		p.bucket = []byte(name)
+	}
+}
+
+// DefaultGCInterval is how often a [Provider] deletes expired leases
+// unless overridden with [WithGCInterval].
+const DefaultGCInterval = gc.DefaultInterval
+
+// WithGCInterval is an [Option] that sets how often the provider sweeps expired leases from its bucket.
+// A value of zero or less disables the background sweep;
+// expired leases can still be deleted on demand with [Provider.GC].
+func WithGCInterval(d time.Duration) Option {
+	return func(p *Provider) {
+		p.gcConfig.Interval = d
+	}
+}
+
+// WithGCHook is an [Option] that sets a function to call after each background sweep
+// with the number of expired leases deleted and the error, if any.
+func WithGCHook(f func(deleted int64, err error)) Option {
+	return func(p *Provider) {
+		p.gcConfig.Hook = f
+	}
+}
+
+// Close stops the background sweep (if any) and waits for it to exit.
+// It does _not_ close the underlying database.
+func (p *Provider) Close() {
+	p.collector.Stop()
+}
+
+// record is the JSON-encoded value stored for a lease.
+type record struct {
+	Secret string    `json:"secret"`
+	Exp    time.Time `json:"exp"`
+}
+
+// GC deletes expired leases from the provider's bucket,
+// returning the number deleted.
+// It is called periodically in the background unless disabled with [WithGCInterval],
+// but may also be called directly.
+func (p *Provider) GC(context.Context) (int64, error) {
+	var n int64
+
+	err := p.db.Update(func(tx *bbolt.Tx) error {
+		var (
+			bucket  = tx.Bucket(p.bucket)
+			now     = p.Now()
+			expired [][]byte
+		)
+
+		// Deleting while iterating with a cursor can skip keys,
+		// so collect the expired ones first.
+		err := bucket.ForEach(func(k, v []byte) error {
+			var rec record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return errors.Wrapf(err, "decoding lease %s", k)
+			}
+			if rec.Exp.Before(now) {
+				expired = append(expired, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return errors.Wrapf(err, "deleting lease %s", k)
+			}
+			n++
+		}
+		return nil
+	})
+
+	return n, err
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	secret, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	err = p.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(p.bucket)
+
+		rec, ok, err := getRecord(bucket, name)
+		if err != nil {
+			return err
+		}
+		if ok && rec.Exp.After(p.Now()) {
+			return lease.ErrHeld
+		}
+
+		return putRecord(bucket, name, record{Secret: secret, Exp: exp})
+	})
+	if errors.Is(err, lease.ErrHeld) {
+		return "", time.Time{}, err
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, exp, nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	err := p.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(p.bucket)
+
+		rec, ok, err := getRecord(bucket, name)
+		if err != nil {
+			return err
+		}
+		if !ok || rec.Secret != secret || !rec.Exp.After(p.Now()) {
+			return lease.ErrNotHeld
+		}
+
+		rec.Exp = exp
+		return putRecord(bucket, name, rec)
+	})
+	if errors.Is(err, lease.ErrNotHeld) {
+		return time.Time{}, err
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return exp, nil
+}
+
+func (p *Provider) Release(_ context.Context, name, secret string) error {
+	err := p.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(p.bucket)
+
+		rec, ok, err := getRecord(bucket, name)
+		if err != nil {
+			return err
+		}
+		if !ok || rec.Secret != secret {
+			return lease.ErrNotHeld
+		}
+
+		return bucket.Delete([]byte(name))
+	})
+	if errors.Is(err, lease.ErrNotHeld) {
+		return err
+	}
+	return errors.Wrapf(err, "releasing lease %s", name)
+}
+
+// getRecord gets the record for the given lease name from the bucket.
+// Its boolean result is false if there is none.
+func getRecord(bucket *bbolt.Bucket, name string) (record, bool, error) {
+	var rec record
+
+	v := bucket.Get([]byte(name))
+	if v == nil {
+		return rec, false, nil
+	}
+	if err := json.Unmarshal(v, &rec); err != nil {
+		return rec, false, errors.Wrap(err, "decoding lease")
+	}
+	return rec, true, nil
+}
+
+func putRecord(bucket *bbolt.Bucket, name string, rec record) error {
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encoding lease")
+	}
+	return bucket.Put([]byte(name), v)
+}
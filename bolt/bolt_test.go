@@ -0,0 +1,91 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(db *bbolt.DB) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(db, WithClock(clock))
+	}
+}
+
+func TestProvider(t *testing.T) {
+	withDB(t, func(db *bbolt.DB) {
+		testutil.Provider(context.Background(), t, factory(db))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	withDB(t, func(db *bbolt.DB) {
+		testutil.Leader(context.Background(), t, factory(db))
+	})
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(t, func(db *bbolt.DB) {
+		var (
+			mockClock = clock.NewMock()
+			t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+		)
+		mockClock.Set(t0)
+
+		p, err := New(db, WithClock(mockClock), WithGCInterval(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+
+		for i := 0; i < 5; i++ {
+			exp := t0.Add(10 * time.Second)
+			if i%2 == 0 {
+				exp = t0.Add(30 * time.Second)
+			}
+			if _, _, err := p.Acquire(ctx, fmt.Sprintf("gc%d", i), exp); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mockClock.Add(20 * time.Second)
+
+		n, err := p.GC(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("got %d deleted, want 2", n)
+		}
+
+		mockClock.Add(20 * time.Second)
+
+		n, err = p.GC(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 {
+			t.Errorf("got %d deleted, want 3", n)
+		}
+	})
+}
+
+func withDB(t *testing.T, f func(*bbolt.DB)) {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "leases.db"), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	f(db)
+}
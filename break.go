@@ -0,0 +1,17 @@
+package lease
+
+import "context"
+
+// Breaker is implemented by a [Provider] that can forcibly end a lease
+// without knowing its secret,
+// e.g. when an operator must revoke the lease of a holder that is wedged but still renewing.
+type Breaker interface {
+	// Break ends the lease with the given name, whoever holds it,
+	// so that the holder's next call to Renew or Release fails with [ErrNotHeld]
+	// (and so that a [Leader.Run] callback holding it is canceled at its next renewal).
+	// A [Historian] records the given reason
+	// with an [EventBreak] event.
+	//
+	// Break returns [ErrNotHeld] if the lease is not held.
+	Break(ctx context.Context, name, reason string) error
+}
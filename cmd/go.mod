@@ -0,0 +1,28 @@
+module github.com/bobg/lease/v2/cmd
+
+go 1.22.0
+
+require (
+	github.com/bobg/errors v1.1.0
+	github.com/bobg/lease/v2 v2.0.0
+	github.com/bobg/lease/v2/sqlite v0.0.0
+	github.com/lib/pq v1.10.9
+	modernc.org/sqlite v1.34.5
+)
+
+require (
+	github.com/bobg/retry v0.2.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+)
+
+replace github.com/bobg/lease/v2 => ../
+
+replace github.com/bobg/lease/v2/sqlite => ../sqlite
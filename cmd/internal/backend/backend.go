@@ -0,0 +1,125 @@
+// Package backend selects a lease provider from command-line flags,
+// for the commands in github.com/bobg/lease/v2/cmd.
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bobg/errors"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/httpclient"
+	"github.com/bobg/lease/v2/pg"
+	"github.com/bobg/lease/v2/sqlite"
+)
+
+// ErrNone is the error returned by [Flags.Open] when no backend is selected.
+var ErrNone = errors.New("one of -server, -pg, and -sqlite is required")
+
+// Flags selects a backend:
+// a lease server
+// (as served by github.com/bobg/lease/v2/httpserver),
+// a PostgresQL database
+// (as used by github.com/bobg/lease/v2/pg and github.com/bobg/lease/v2/pgx),
+// or a SQLite database file
+// (as used by github.com/bobg/lease/v2/sqlite).
+type Flags struct {
+	ServerURL, Token string
+	DSN, SQLite      string
+	Table            string
+}
+
+// sqliteBusyTimeout is how long a SQLite backend waits
+// for other processes to release the database's write lock.
+const sqliteBusyTimeout = 5 * time.Second
+
+// Register defines flags for f in fs.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.ServerURL, "server", "", "base URL of a lease server")
+	fs.StringVar(&f.Token, "token", os.Getenv("LEASE_TOKEN"), "bearer token for the lease server (default $LEASE_TOKEN)")
+	fs.StringVar(&f.DSN, "pg", "", "PostgresQL connection string")
+	fs.StringVar(&f.SQLite, "sqlite", "", "SQLite database file")
+	fs.StringVar(&f.Table, "table", "leases", "lease table in the PostgresQL or SQLite database")
+}
+
+// Check reports an error if more than one backend is selected.
+func (f Flags) Check() error {
+	var n int
+	for _, s := range []string{f.ServerURL, f.DSN, f.SQLite} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("-server, -pg, and -sqlite are mutually exclusive")
+	}
+	return nil
+}
+
+// Database tells whether the selected backend is a database
+// (rather than a lease server, or nothing).
+func (f Flags) Database() bool {
+	return f.DSN != "" || f.SQLite != ""
+}
+
+// Open opens the selected backend,
+// returning its provider and a function that closes it.
+// It returns [ErrNone] if no backend is selected.
+func (f Flags) Open(ctx context.Context) (lease.Provider, func(), error) {
+	if err := f.Check(); err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case f.ServerURL != "":
+		var opts []httpclient.Option
+		if f.Token != "" {
+			opts = append(opts, httpclient.WithToken(f.Token))
+		}
+		return httpclient.New(f.ServerURL, opts...), func() {}, nil
+
+	case f.DSN != "":
+		db, err := sql.Open("postgres", f.DSN)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "opening database")
+		}
+		p, err := pg.New(ctx, db, f.Table)
+		if err != nil {
+			db.Close()
+			return nil, nil, errors.Wrap(err, "creating provider")
+		}
+		return p, func() { p.Close(); db.Close() }, nil
+
+	case f.SQLite != "":
+		db, err := sql.Open("sqlite", f.SQLite)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "opening database")
+		}
+
+		// The busy timeout is a per-connection setting,
+		// so use just one connection.
+		db.SetMaxOpenConns(1)
+		q := fmt.Sprintf("PRAGMA busy_timeout = %d", sqliteBusyTimeout.Milliseconds())
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			db.Close()
+			return nil, nil, errors.Wrap(err, "setting busy timeout")
+		}
+
+		p, err := sqlite.New(ctx, db, f.Table)
+		if err != nil {
+			db.Close()
+			return nil, nil, errors.Wrap(err, "creating provider")
+		}
+		return p, func() { p.Close(); db.Close() }, nil
+
+	default:
+		return nil, nil, ErrNone
+	}
+}
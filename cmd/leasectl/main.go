@@ -0,0 +1,408 @@
+// Command leasectl inspects and manipulates leases.
+//
+// Usage:
+//
+//	leasectl [-server URL [-token TOKEN] | -pg DSN [-table TABLE] | -sqlite FILE [-table TABLE]] [-format table|json] SUBCOMMAND ARGS
+//
+// The backend is a lease server
+// (as served by github.com/bobg/lease/v2/httpserver, or by "leasectl serve"),
+// a PostgresQL database
+// (as used by github.com/bobg/lease/v2/pg and github.com/bobg/lease/v2/pgx),
+// or a SQLite database file
+// (as used by github.com/bobg/lease/v2/sqlite).
+//
+// The subcommands are:
+//
+//	acquire [-holder HOLDER] -ttl DURATION NAME  Acquire a lease and print its secret.
+//	renew [-holder HOLDER] -ttl DURATION NAME SECRET  Renew a lease.
+//	release [-holder HOLDER] NAME SECRET  Release a lease.
+//	break [-holder HOLDER] -reason REASON NAME  Forcibly end a lease, whoever holds it.
+//	list [-prefix PREFIX]  List the held leases.
+//	describe NAME  Describe a held lease.
+//	serve [-addr ADDR]  Serve the HTTP lease API, backed by -pg or -sqlite if given and in memory otherwise.
+//
+// The exit status is 2 if the lease to be acquired is already held,
+// or if the lease to be renewed, released, broken, or described is not held (by the caller, for renew and release);
+// and 1 on other errors.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/cmd/internal/backend"
+	"github.com/bobg/lease/v2/httpserver"
+	"github.com/bobg/lease/v2/mem"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	err := run(ctx, os.Args[1:], os.Stdout)
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "leasectl: %s\n", err)
+	if errors.Is(err, lease.ErrHeld) || errors.Is(err, lease.ErrNotHeld) {
+		os.Exit(2)
+	}
+	os.Exit(1)
+}
+
+// errUsage is returned for command-line errors.
+var errUsage = errors.New("usage: leasectl [-server URL [-token TOKEN] | -pg DSN [-table TABLE] | -sqlite FILE [-table TABLE]] [-format table|json] acquire|renew|release|break|list|describe|serve ARGS")
+
+type command struct {
+	out    io.Writer
+	format string
+
+	backend backend.Flags
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	c := command{out: out}
+
+	fs := flag.NewFlagSet("leasectl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.backend.Register(fs)
+	fs.StringVar(&c.format, "format", "table", "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+
+	if err := c.backend.Check(); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+
+	switch {
+	case c.format != "table" && c.format != "json":
+		return errors.Wrapf(errUsage, "unknown format %s", c.format)
+	case fs.NArg() == 0:
+		return errUsage
+	}
+
+	args = fs.Args()[1:]
+
+	switch fs.Arg(0) {
+	case "acquire":
+		return c.acquire(ctx, args)
+	case "renew":
+		return c.renew(ctx, args)
+	case "release":
+		return c.release(ctx, args)
+	case "break":
+		return c.breakLease(ctx, args)
+	case "list":
+		return c.list(ctx, args)
+	case "describe":
+		return c.describe(ctx, args)
+	case "serve":
+		return c.serve(ctx, args)
+	default:
+		return errors.Wrapf(errUsage, "unknown subcommand %s", fs.Arg(0))
+	}
+}
+
+func (c command) acquire(ctx context.Context, args []string) error {
+	var (
+		holder string
+		ttl    time.Duration
+	)
+	fs := flag.NewFlagSet("acquire", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&holder, "holder", "", "holder identity to record")
+	fs.DurationVar(&ttl, "ttl", 0, "lease duration")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+	if fs.NArg() != 1 || ttl <= 0 {
+		return errors.Wrap(errUsage, "acquire [-holder HOLDER] -ttl DURATION NAME")
+	}
+	name := fs.Arg(0)
+
+	return c.withProvider(ctx, func(p lease.Provider) error {
+		secret, exp, err := acquireTTL(lease.WithHolder(ctx, holder), p, name, ttl)
+		if err != nil {
+			return errors.Wrapf(err, "acquiring lease %s", name)
+		}
+		return c.printOne([]string{"NAME", "SECRET", "EXPIRES"}, leaseJSON{Name: name, Secret: secret, Exp: exp})
+	})
+}
+
+func (c command) renew(ctx context.Context, args []string) error {
+	var (
+		holder string
+		ttl    time.Duration
+	)
+	fs := flag.NewFlagSet("renew", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&holder, "holder", "", "holder identity to record")
+	fs.DurationVar(&ttl, "ttl", 0, "new lease duration, from now")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+	if fs.NArg() != 2 || ttl <= 0 {
+		return errors.Wrap(errUsage, "renew [-holder HOLDER] -ttl DURATION NAME SECRET")
+	}
+	name, secret := fs.Arg(0), fs.Arg(1)
+
+	return c.withProvider(ctx, func(p lease.Provider) error {
+		exp, err := renewTTL(lease.WithHolder(ctx, holder), p, name, secret, ttl)
+		if err != nil {
+			return errors.Wrapf(err, "renewing lease %s", name)
+		}
+		return c.printOne([]string{"NAME", "EXPIRES"}, leaseJSON{Name: name, Exp: exp})
+	})
+}
+
+// acquireTTL acquires the named lease for ttl from now,
+// letting p measure the duration if it is a [lease.TTLProvider].
+func acquireTTL(ctx context.Context, p lease.Provider, name string, ttl time.Duration) (string, time.Time, error) {
+	if tp, ok := p.(lease.TTLProvider); ok {
+		secret, exp, err := tp.AcquireTTL(ctx, name, ttl)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return secret, exp, err
+		}
+		// Otherwise fall back to computing the expiration time here.
+	}
+	return p.Acquire(ctx, name, p.Now().Add(ttl))
+}
+
+// renewTTL renews the named lease for ttl from now,
+// letting p measure the duration if it is a [lease.TTLProvider].
+func renewTTL(ctx context.Context, p lease.Provider, name, secret string, ttl time.Duration) (time.Time, error) {
+	if tp, ok := p.(lease.TTLProvider); ok {
+		exp, err := tp.RenewTTL(ctx, name, secret, ttl)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return exp, err
+		}
+		// Otherwise fall back to computing the expiration time here.
+	}
+	return p.Renew(ctx, name, secret, p.Now().Add(ttl))
+}
+
+func (c command) release(ctx context.Context, args []string) error {
+	var holder string
+	fs := flag.NewFlagSet("release", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&holder, "holder", "", "holder identity to record")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+	if fs.NArg() != 2 {
+		return errors.Wrap(errUsage, "release [-holder HOLDER] NAME SECRET")
+	}
+	name, secret := fs.Arg(0), fs.Arg(1)
+
+	return c.withProvider(ctx, func(p lease.Provider) error {
+		return errors.Wrapf(p.Release(lease.WithHolder(ctx, holder), name, secret), "releasing lease %s", name)
+	})
+}
+
+func (c command) breakLease(ctx context.Context, args []string) error {
+	var holder, reason string
+	fs := flag.NewFlagSet("break", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&holder, "holder", "", "identity of the operator breaking the lease, to record")
+	fs.StringVar(&reason, "reason", "", "why the lease is being broken, to record")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+	if fs.NArg() != 1 || reason == "" {
+		return errors.Wrap(errUsage, "break [-holder HOLDER] -reason REASON NAME")
+	}
+	name := fs.Arg(0)
+
+	return c.withProvider(ctx, func(p lease.Provider) error {
+		b, ok := p.(lease.Breaker)
+		if !ok {
+			return errors.New("backend cannot break leases")
+		}
+		return errors.Wrapf(b.Break(lease.WithHolder(ctx, holder), name, reason), "breaking lease %s", name)
+	})
+}
+
+func (c command) list(ctx context.Context, args []string) error {
+	var prefix string
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&prefix, "prefix", "", "list only leases whose names begin with this")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+	if fs.NArg() != 0 {
+		return errors.Wrap(errUsage, "list [-prefix PREFIX]")
+	}
+
+	return c.withInspector(ctx, func(p lease.Provider, insp lease.Inspector) error {
+		infos, err := insp.List(ctx, prefix)
+		if err != nil {
+			return errors.Wrap(err, "listing leases")
+		}
+		leases := []leaseJSON{} // not null in the JSON
+		for _, info := range infos {
+			leases = append(leases, leaseJSON{Name: info.Name, Exp: info.Exp, TTL: ttlFor(p, info.Exp)})
+		}
+		return c.printList([]string{"NAME", "EXPIRES", "TTL"}, leases)
+	})
+}
+
+func (c command) describe(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.Wrap(errUsage, "describe NAME")
+	}
+	name := args[0]
+
+	return c.withInspector(ctx, func(p lease.Provider, insp lease.Inspector) error {
+		info, ok, err := insp.Inspect(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "inspecting lease %s", name)
+		}
+		if !ok {
+			return errors.Wrapf(lease.ErrNotHeld, "lease %s", name)
+		}
+		return c.printOne([]string{"NAME", "EXPIRES", "TTL"}, leaseJSON{Name: info.Name, Exp: info.Exp, TTL: ttlFor(p, info.Exp)})
+	})
+}
+
+func (c command) serve(ctx context.Context, args []string) error {
+	var addr string
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&addr, "addr", ":8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+	if fs.NArg() != 0 {
+		return errors.Wrap(errUsage, "serve [-addr ADDR]")
+	}
+	if c.backend.ServerURL != "" {
+		return errors.Wrap(errUsage, "serve cannot use -server")
+	}
+
+	serve := func(p lease.Provider) error {
+		srv := &http.Server{Addr: addr, Handler: httpserver.New(p)}
+		go func() {
+			<-ctx.Done()
+			_ = srv.Shutdown(context.Background())
+		}()
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+
+	if !c.backend.Database() {
+		return serve(mem.New())
+	}
+	return c.withProvider(ctx, serve)
+}
+
+// withProvider calls f with the provider for the selected backend.
+func (c command) withProvider(ctx context.Context, f func(lease.Provider) error) error {
+	p, closeFn, err := c.backend.Open(ctx)
+	if errors.Is(err, backend.ErrNone) {
+		return errors.Wrapf(errUsage, "%s", err)
+	}
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	return f(p)
+}
+
+// withInspector calls f with the provider for the selected backend,
+// which must also be a [lease.Inspector].
+func (c command) withInspector(ctx context.Context, f func(lease.Provider, lease.Inspector) error) error {
+	return c.withProvider(ctx, func(p lease.Provider) error {
+		insp, ok := p.(lease.Inspector)
+		if !ok {
+			return errors.New("backend does not support inspection")
+		}
+		return f(p, insp)
+	})
+}
+
+// leaseJSON is the output for a lease.
+// Fields with zero values are omitted.
+type leaseJSON struct {
+	Name   string    `json:"name"`
+	Secret string    `json:"secret,omitempty"`
+	Exp    time.Time `json:"exp"`
+	TTL    string    `json:"ttl,omitempty"` // time remaining
+}
+
+// printOne prints the given lease,
+// as a table with the given columns
+// or as a JSON object.
+func (c command) printOne(cols []string, l leaseJSON) error {
+	if c.format == "json" {
+		return c.printJSON(l)
+	}
+	return c.printTable(cols, []leaseJSON{l})
+}
+
+// printList prints the given leases,
+// as a table with the given columns
+// or as a JSON array.
+func (c command) printList(cols []string, leases []leaseJSON) error {
+	if c.format == "json" {
+		return c.printJSON(leases)
+	}
+	return c.printTable(cols, leases)
+}
+
+func (c command) printJSON(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c command) printTable(cols []string, leases []leaseJSON) error {
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	for i, col := range cols {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, col)
+	}
+	fmt.Fprintln(w)
+
+	for _, l := range leases {
+		for i, col := range cols {
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			switch col {
+			case "NAME":
+				fmt.Fprint(w, l.Name)
+			case "SECRET":
+				fmt.Fprint(w, l.Secret)
+			case "EXPIRES":
+				fmt.Fprint(w, l.Exp.Format(time.RFC3339))
+			case "TTL":
+				fmt.Fprint(w, l.TTL)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// ttlFor returns the time remaining until exp, to the second.
+func ttlFor(clock lease.Clock, exp time.Time) string {
+	return exp.Sub(clock.Now()).Round(time.Second).String()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/httpserver"
+	"github.com/bobg/lease/v2/mem"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(httpserver.New(mem.New()))
+	defer srv.Close()
+
+	leasectl := func(format string, args ...string) (string, error) {
+		buf := new(bytes.Buffer)
+		err := run(ctx, append([]string{"-server", srv.URL, "-format", format}, args...), buf)
+		return buf.String(), err
+	}
+
+	out, err := leasectl("json", "acquire", "-ttl", "1m", "-holder", "me", "a/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acquired leaseJSON
+	if err := json.Unmarshal([]byte(out), &acquired); err != nil {
+		t.Fatal(err)
+	}
+	if acquired.Name != "a/x" || acquired.Secret == "" {
+		t.Fatalf("got %+v, want name a/x and a secret", acquired)
+	}
+
+	if _, err := leasectl("table", "acquire", "-ttl", "1m", "a/x"); !errors.Is(err, lease.ErrHeld) {
+		t.Errorf("got error %v, want ErrHeld", err)
+	}
+
+	if _, err := leasectl("table", "renew", "-ttl", "2m", "a/x", acquired.Secret); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = leasectl("table", "list", "-prefix", "a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "NAME") || !strings.HasPrefix(lines[1], "a/x ") {
+		t.Errorf("got list output %q, want a header and a/x", out)
+	}
+
+	out, err = leasectl("json", "describe", "a/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var described leaseJSON
+	if err := json.Unmarshal([]byte(out), &described); err != nil {
+		t.Fatal(err)
+	}
+	if described.Name != "a/x" || described.TTL != "2m0s" {
+		t.Errorf("got %+v, want a/x with ttl 2m0s", described)
+	}
+
+	if _, err := leasectl("table", "release", "a/x", acquired.Secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leasectl("table", "describe", "a/x"); !errors.Is(err, lease.ErrNotHeld) {
+		t.Errorf("got error %v, want ErrNotHeld", err)
+	}
+
+	out, err = leasectl("json", "acquire", "-ttl", "1m", "a/y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(out), &acquired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leasectl("table", "break", "-holder", "operator", "-reason", "wedged", "a/y"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leasectl("table", "renew", "-ttl", "1m", "a/y", acquired.Secret); !errors.Is(err, lease.ErrNotHeld) {
+		t.Errorf("got error %v, want ErrNotHeld", err)
+	}
+	if _, err := leasectl("table", "break", "-reason", "wedged", "a/y"); !errors.Is(err, lease.ErrNotHeld) {
+		t.Errorf("got error %v, want ErrNotHeld", err)
+	}
+
+	out, err = leasectl("json", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out) != "[]" {
+		t.Errorf("got list output %q, want []", out)
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		file = filepath.Join(t.TempDir(), "leases.db")
+	)
+
+	// Each call opens the database anew.
+	leasectl := func(args ...string) (string, error) {
+		buf := new(bytes.Buffer)
+		err := run(ctx, append([]string{"-sqlite", file, "-format", "json"}, args...), buf)
+		return buf.String(), err
+	}
+
+	out, err := leasectl("acquire", "-ttl", "1m", "a/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acquired leaseJSON
+	if err := json.Unmarshal([]byte(out), &acquired); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := leasectl("acquire", "-ttl", "1m", "a/x"); !errors.Is(err, lease.ErrHeld) {
+		t.Errorf("got error %v, want ErrHeld", err)
+	}
+
+	out, err = leasectl("list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []leaseJSON
+	if err := json.Unmarshal([]byte(out), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Name != "a/x" {
+		t.Errorf("got list %+v, want a/x", listed)
+	}
+
+	if _, err := leasectl("break", "-reason", "wedged", "a/x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leasectl("release", "a/x", acquired.Secret); !errors.Is(err, lease.ErrNotHeld) {
+		t.Errorf("got error %v, want ErrNotHeld", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	ctx := context.Background()
+
+	for _, args := range [][]string{
+		nil,
+		{"-server", "http://x", "bogus"},
+		{"-server", "http://x", "-pg", "dbname=x", "list"},
+		{"-pg", "dbname=x", "-sqlite", "x.db", "list"},
+		{"-server", "http://x", "-format", "yaml", "list"},
+		{"-server", "http://x", "acquire", "a"},
+		{"-server", "http://x", "break", "a"},
+		{"-server", "http://x", "serve"},
+		{"list"},
+	} {
+		if err := run(ctx, args, new(bytes.Buffer)); !errors.Is(err, errUsage) {
+			t.Errorf("%v: got error %v, want errUsage", args, err)
+		}
+	}
+}
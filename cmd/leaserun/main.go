@@ -0,0 +1,211 @@
+// Command leaserun runs a command while holding a lease,
+// like a distributed flock(1).
+//
+// Usage:
+//
+//	leaserun [-server URL [-token TOKEN] | -pg DSN [-table TABLE] | -sqlite FILE [-table TABLE]] -name NAME [-dur DURATION] [-renew DURATION] [-wait] [-retry DURATION] [-grace DURATION] [-holder HOLDER] -- COMMAND ARGS...
+//
+// The backend is a lease server
+// (as served by github.com/bobg/lease/v2/httpserver),
+// a PostgresQL database
+// (as used by github.com/bobg/lease/v2/pg and github.com/bobg/lease/v2/pgx),
+// or a SQLite database file
+// (as used by github.com/bobg/lease/v2/sqlite).
+//
+// Leaserun acquires the lease with the given name
+// (see [lease.Leader]),
+// then runs the command,
+// renewing the lease until the command exits,
+// and then releasing it.
+// Signals received by leaserun are forwarded to the command.
+//
+// If the lease cannot be renewed,
+// leaserun sends the command SIGTERM,
+// and then, if it has not exited after the grace period, SIGKILL.
+//
+// If the lease is held elsewhere,
+// leaserun exits immediately with status 75,
+// unless -wait is given,
+// in which case it retries until it acquires the lease.
+// Otherwise the exit status is that of the command,
+// or 128 plus the signal number if the command was killed by a signal,
+// or 1 if leaserun encounters an error.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/cmd/internal/backend"
+)
+
+// ExitHeld is the exit status when the lease is held elsewhere.
+// It is EX_TEMPFAIL from sysexits.h.
+const ExitHeld = 75
+
+func main() {
+	code, err := run(context.Background(), os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "leaserun: %s\n", err)
+	}
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string) (int, error) {
+	var (
+		bflags backend.Flags
+		r      runner
+		wait   bool
+	)
+
+	fs := flag.NewFlagSet("leaserun", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	bflags.Register(fs)
+	fs.StringVar(&r.leader.Name, "name", "", "name of the lease")
+	fs.DurationVar(&r.leader.Dur, "dur", time.Minute, "lease duration")
+	fs.DurationVar(&r.leader.Renew, "renew", 0, "how often to renew the lease (default adaptive; see lease.Leader)")
+	fs.BoolVar(&wait, "wait", false, "wait for the lease if it is held elsewhere")
+	fs.DurationVar(&r.leader.Retry, "retry", 5*time.Second, "with -wait, how often to retry acquiring the lease")
+	fs.DurationVar(&r.grace, "grace", 10*time.Second, "how long to wait after SIGTERM before SIGKILL when the lease is lost")
+	fs.StringVar(&r.holder, "holder", defaultHolder(), "holder identity to record")
+	if err := fs.Parse(args); err != nil {
+		return 1, err
+	}
+
+	switch {
+	case r.leader.Name == "":
+		return 1, errors.New("-name is required")
+	case fs.NArg() == 0:
+		return 1, errors.New("no command given")
+	}
+	if err := r.leader.Validate(); err != nil {
+		return 1, err
+	}
+	if !wait {
+		r.leader.Tries = 1
+	}
+	r.argv = fs.Args()
+	r.stdin, r.stdout, r.stderr = os.Stdin, os.Stdout, os.Stderr
+
+	p, closeFn, err := bflags.Open(ctx)
+	if err != nil {
+		return 1, err
+	}
+	defer closeFn()
+
+	return r.run(ctx, p)
+}
+
+// runner runs a command under a lease.
+type runner struct {
+	leader lease.Leader
+	argv   []string
+	grace  time.Duration
+	holder string
+
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+func (r runner) run(ctx context.Context, p lease.Provider) (int, error) {
+	ctx, cancel := context.WithCancel(lease.WithHolder(ctx, r.holder))
+	defer cancel()
+
+	// Until the command starts, signals cancel the lease acquisition.
+	// After that, they are forwarded to the command.
+	var (
+		mu      sync.Mutex
+		process *os.Process
+		sigs    = make(chan os.Signal, 1)
+	)
+	signal.Notify(sigs, forwardedSignals...)
+	defer signal.Stop(sigs)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigs:
+				mu.Lock()
+				if process != nil {
+					_ = process.Signal(sig)
+				} else {
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	var code int
+
+	_, err := r.leader.Run(ctx, p, func(ctx context.Context) error {
+		cmd := exec.Command(r.argv[0], r.argv[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = r.stdin, r.stdout, r.stderr
+
+		mu.Lock()
+		err := cmd.Start()
+		if err == nil {
+			process = cmd.Process
+		}
+		mu.Unlock()
+		if err != nil {
+			return errors.Wrapf(err, "starting %s", r.argv[0])
+		}
+
+		done := make(chan struct{})
+		go func() {
+			_ = cmd.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+
+		case <-ctx.Done():
+			// The lease was lost (or acquisition was otherwise canceled).
+			_ = cmd.Process.Signal(terminate)
+			select {
+			case <-done:
+			case <-time.After(r.grace):
+				_ = cmd.Process.Kill()
+				<-done
+			}
+		}
+
+		code = exitCode(cmd.ProcessState)
+
+		if cause := context.Cause(ctx); ctx.Err() != nil {
+			return cause
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, lease.ErrHeld):
+		return ExitHeld, errors.Wrapf(err, "lease %s", r.leader.Name)
+	case errors.As(err, new(lease.RenewError)):
+		return code, err
+	case err != nil:
+		return 1, err
+	}
+	return code, nil
+}
+
+func defaultHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("leaserun@%s[%d]", host, os.Getpid())
+}
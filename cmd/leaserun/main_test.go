@@ -0,0 +1,147 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/mem"
+)
+
+// flaky is a provider whose Renew and RenewTTL fail once broken is set.
+type flaky struct {
+	*mem.Provider
+	broken atomic.Bool
+}
+
+func (f *flaky) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if f.broken.Load() {
+		return time.Time{}, errors.New("broken")
+	}
+	return f.Provider.Renew(ctx, name, secret, exp)
+}
+
+func (f *flaky) RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error) {
+	if f.broken.Load() {
+		return time.Time{}, errors.New("broken")
+	}
+	return f.Provider.RenewTTL(ctx, name, secret, ttl)
+}
+
+func newRunner(script string) (runner, *bytes.Buffer) {
+	out := new(bytes.Buffer)
+	return runner{
+		leader: lease.Leader{Name: "test", Dur: time.Second, Renew: 50 * time.Millisecond, Tries: 1},
+		argv:   []string{"sh", "-c", script},
+		grace:  100 * time.Millisecond,
+		stdout: out,
+	}, out
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	p := mem.New()
+
+	r, out := newRunner("echo hello; exit 3")
+	code, err := r.run(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Errorf("got exit code %d, want 3", code)
+	}
+	if got := strings.TrimSpace(out.String()); got != "hello" {
+		t.Errorf("got output %q, want hello", got)
+	}
+
+	// The lease was released.
+	if _, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Now it is held elsewhere.
+	r, _ = newRunner("exit 0")
+	code, err = r.run(ctx, p)
+	if !errors.Is(err, lease.ErrHeld) {
+		t.Errorf("got error %v, want ErrHeld", err)
+	}
+	if code != ExitHeld {
+		t.Errorf("got exit code %d, want %d", code, ExitHeld)
+	}
+}
+
+func TestLost(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		want   int
+	}{{
+		name:   "terminated",
+		script: "exec sleep 10",
+		want:   128 + 15, // SIGTERM
+	}, {
+		name:   "killed",
+		script: "trap '' TERM; sleep 10",
+		want:   128 + 9, // SIGKILL
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &flaky{Provider: mem.New()}
+
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				p.broken.Store(true)
+			}()
+
+			r, _ := newRunner(tc.script)
+			r.stdout = nil // don't wait for an orphaned sleep to close the output pipe
+			code, err := r.run(context.Background(), p)
+			if !errors.As(err, new(lease.RenewError)) {
+				t.Errorf("got error %v, want a RenewError", err)
+			}
+			if code != tc.want {
+				t.Errorf("got exit code %d, want %d", code, tc.want)
+			}
+		})
+	}
+}
+
+func TestFlags(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{{
+		name: "no_name",
+		args: []string{"true"},
+		want: "-name is required",
+	}, {
+		name: "no_command",
+		args: []string{"-name", "test"},
+		want: "no command given",
+	}, {
+		name: "renew_too_long",
+		args: []string{"-name", "test", "-dur", "1m", "-renew", "1m", "true"},
+		want: (lease.Leader{Name: "test", Dur: time.Minute, Renew: time.Minute}).Validate().Error(),
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := run(context.Background(), tc.args)
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("got error %v, want %s", err, tc.want)
+			}
+			if code != 1 {
+				t.Errorf("got exit code %d, want 1", code)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// forwardedSignals are the signals that leaserun forwards to the command.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// terminate is the signal sent to the command when the lease is lost.
+// Other platforms may not support it,
+// in which case the command is killed after the grace period.
+var terminate os.Signal = os.Interrupt
+
+// exitCode returns the exit status for a command that has exited.
+func exitCode(ps *os.ProcessState) int {
+	return ps.ExitCode()
+}
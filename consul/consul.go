@@ -0,0 +1,268 @@
+// Package consul implements [lease.Provider] in terms of Consul sessions and key-value locks.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bobg/errors"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Provider is a lease.Provider implemented in terms of Consul sessions and key-value locks.
+//
+// Acquiring a lease creates a Consul session
+// and uses it to lock the lease's key.
+// The session ID is the lease's secret.
+// Renewing the lease renews the session,
+// and releasing it destroys the session.
+//
+// Sessions are created with the "delete" behavior,
+// so Consul deletes the key when the session is invalidated:
+// when the session's TTL lapses without renewal,
+// or when one of the session's health checks fails
+// (see [WithChecks] and [WithServiceChecks]).
+// This ties leases to the health of the agents and services holding them.
+//
+// Expiration is otherwise decided according to the provider's clock (see [WithClock]).
+type Provider struct {
+	lease.Clock
+
+	client        *api.Client
+	prefix        string
+	checks        []string
+	serviceChecks []api.ServiceCheck
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new Consul lease provider using the given client.
+func New(client *api.Client, opts ...Option) *Provider {
+	p := &Provider{
+		Clock:  lease.DefaultClock{},
+		client: client,
+		prefix: DefaultPrefix,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// DefaultPrefix is the key prefix for leases
+// unless overridden with [WithPrefix].
+const DefaultPrefix = "lease/"
+
+// WithPrefix is an [Option] that sets the prefix of the Consul keys in which leases are stored.
+// The key for a lease is the prefix followed by the lease name.
+func WithPrefix(prefix string) Option {
+	return func(p *Provider) {
+		p.prefix = prefix
+	}
+}
+
+// WithChecks is an [Option] that sets the node health checks associated with the sessions of acquired leases.
+// A lease is lost if any of them becomes critical.
+//
+// When this option is not given,
+// Consul associates the node's serfHealth check with each session.
+// When it is, serfHealth is not included unless it is one of the given checks.
+func WithChecks(checks ...string) Option {
+	return func(p *Provider) {
+		p.checks = checks
+	}
+}
+
+// WithServiceChecks is an [Option] that sets the service health checks associated with the sessions of acquired leases.
+// A lease is lost if any of them becomes critical.
+func WithServiceChecks(checks ...api.ServiceCheck) Option {
+	return func(p *Provider) {
+		p.serviceChecks = checks
+	}
+}
+
+// Consul limits on session TTLs.
+const (
+	minTTL = 10 * time.Second
+	maxTTL = 24 * time.Hour
+)
+
+// record is the JSON-encoded value stored under a lease's key.
+type record struct {
+	Exp time.Time `json:"exp"`
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	key := p.prefix + name
+
+	pair, _, err := p.client.KV().Get(key, p.queryOpts(ctx))
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if pair != nil && pair.Session != "" {
+		var rec record
+		if err := json.Unmarshal(pair.Value, &rec); err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "decoding lease %s", name)
+		}
+		if rec.Exp.After(p.Now()) {
+			return "", time.Time{}, lease.ErrHeld
+		}
+
+		// The lease has expired.
+		// Delete its key (unless someone else has changed it in the meantime)
+		// and end the previous holder's session.
+		ok, _, err := p.client.KV().DeleteCAS(pair, p.writeOpts(ctx))
+		if err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "deleting expired lease %s", name)
+		}
+		if !ok {
+			return "", time.Time{}, lease.ErrHeld
+		}
+		_, _ = p.client.Session().Destroy(pair.Session, p.writeOpts(ctx))
+	}
+
+	// The session's TTL covers the time until exp, rounded up to whole seconds.
+	ttl := (exp.Sub(p.Now()) + time.Second - 1).Truncate(time.Second)
+	ttl = min(max(ttl, minTTL), maxTTL)
+
+	// As in Renew, the lease lasts no longer than Consul guarantees the session.
+	if limit := p.Now().Add(ttl); limit.Before(exp) {
+		exp = limit
+	}
+
+	session, _, err := p.client.Session().Create(&api.SessionEntry{
+		Name:          "lease " + name,
+		Behavior:      api.SessionBehaviorDelete,
+		TTL:           ttl.String(),
+		NodeChecks:    p.checks,
+		ServiceChecks: p.serviceChecks,
+
+		// Expiration is governed by the provider's clock.
+		// Consul's default lock delay would keep a lease whose holder's session was invalidated
+		// from being acquired for a while longer.
+		LockDelay: time.Millisecond,
+	}, p.writeOpts(ctx))
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "creating session for lease %s", name)
+	}
+
+	value, err := json.Marshal(record{Exp: exp})
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "encoding lease")
+	}
+
+	ok, _, err := p.client.KV().Acquire(&api.KVPair{Key: key, Value: value, Session: session}, p.writeOpts(ctx))
+	if err != nil || !ok {
+		_, _ = p.client.Session().Destroy(session, p.writeOpts(ctx))
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+	if !ok {
+		return "", time.Time{}, lease.ErrHeld
+	}
+
+	return session, exp, nil
+}
+
+// Renew implements [lease.Provider.Renew].
+//
+// The new expiration time is limited by the TTL of the lease's session,
+// which is fixed when the lease is acquired:
+// Consul guarantees the session (and so the lease) only for that long after each renewal.
+// The limited expiration time is the one returned.
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	key := p.prefix + name
+
+	pair, _, err := p.client.KV().Get(key, p.queryOpts(ctx))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if pair == nil || pair.Session != secret {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	var rec record
+	if err := json.Unmarshal(pair.Value, &rec); err != nil {
+		return time.Time{}, errors.Wrapf(err, "decoding lease %s", name)
+	}
+	if !rec.Exp.After(p.Now()) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	entry, _, err := p.client.Session().Renew(secret, p.writeOpts(ctx))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing session for lease %s", name)
+	}
+	if entry == nil {
+		// The session has been invalidated.
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if ttl, err := time.ParseDuration(entry.TTL); err == nil {
+		if limit := p.Now().Add(ttl); limit.Before(exp) {
+			exp = limit
+		}
+	}
+
+	value, err := json.Marshal(record{Exp: exp})
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "encoding lease")
+	}
+
+	// Rewrite the key, provided it is unchanged since it was read.
+	ok, _, _, err := p.client.Txn().Txn(api.TxnOps{
+		{KV: &api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: pair.ModifyIndex}},
+		{KV: &api.KVTxnOp{Verb: api.KVLock, Key: key, Value: value, Session: secret}},
+	}, p.queryOpts(ctx))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	if !ok {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	return exp, nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	pair, _, err := p.client.KV().Get(p.prefix+name, p.queryOpts(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "getting lease %s", name)
+	}
+	if pair == nil || pair.Session != secret {
+		return lease.ErrNotHeld
+	}
+
+	// Destroying the session deletes the key.
+	_, err = p.client.Session().Destroy(secret, p.writeOpts(ctx))
+	return errors.Wrapf(err, "destroying session for lease %s", name)
+}
+
+func (p *Provider) queryOpts(ctx context.Context) *api.QueryOptions {
+	return (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx)
+}
+
+func (p *Provider) writeOpts(ctx context.Context) *api.WriteOptions {
+	return (&api.WriteOptions{}).WithContext(ctx)
+}
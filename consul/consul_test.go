@@ -0,0 +1,83 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(client *api.Client, prefix string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(client, WithPrefix(prefix), WithClock(clock)), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	withClient(t, func(client *api.Client, prefix string) {
+		testutil.Provider(context.Background(), t, factory(client, prefix))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	withClient(t, func(client *api.Client, prefix string) {
+		testutil.Leader(context.Background(), t, factory(client, prefix))
+	})
+}
+
+func TestSessionInvalidated(t *testing.T) {
+	ctx := context.Background()
+
+	withClient(t, func(client *api.Client, prefix string) {
+		p := New(client, WithPrefix(prefix))
+
+		secret, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Invalidating the session (as a failed health check would)
+		// releases the lease.
+		if _, err := client.Session().Destroy(secret, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := p.Renew(ctx, "test", secret, time.Now().Add(time.Minute)); !errors.Is(err, lease.ErrNotHeld) {
+			t.Errorf("got error %v, want ErrNotHeld", err)
+		}
+
+		secret2, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Release(ctx, "test", secret2); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// withClient calls f with a client for the Consul agent at CONSUL_HTTP_ADDR
+// (e.g. one started with "consul agent -dev")
+// and a fresh key prefix.
+func withClient(t *testing.T, f func(*api.Client, string)) {
+	if os.Getenv("CONSUL_HTTP_ADDR") == "" {
+		t.Skip("CONSUL_HTTP_ADDR must be set")
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := fmt.Sprintf("lease-test-%d/", time.Now().UnixNano())
+	defer client.KV().DeleteTree(prefix, nil)
+
+	f(client, prefix)
+}
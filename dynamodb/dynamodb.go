@@ -0,0 +1,238 @@
+// Package dynamodb implements [lease.Provider] in terms of an Amazon DynamoDB table.
+package dynamodb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Client is the subset of the DynamoDB API used by [Provider].
+// It is satisfied by [*ddb.Client].
+type Client interface {
+	PutItem(context.Context, *ddb.PutItemInput, ...func(*ddb.Options)) (*ddb.PutItemOutput, error)
+	UpdateItem(context.Context, *ddb.UpdateItemInput, ...func(*ddb.Options)) (*ddb.UpdateItemOutput, error)
+	DeleteItem(context.Context, *ddb.DeleteItemInput, ...func(*ddb.Options)) (*ddb.DeleteItemOutput, error)
+}
+
+// Provider is a lease.Provider implemented in terms of a DynamoDB table.
+//
+// Each lease is an item whose partition key is the lease name
+// (in the string attribute "name"),
+// with its secret and expiration time
+// (in nanoseconds since the epoch)
+// in the attributes "secret" and "exp_ns".
+// Acquire, Renew, and Release are single conditional writes on those attributes.
+//
+// DynamoDB has no notion of the current time in condition expressions,
+// so expiration is decided by the provider's clock (see [WithClock]).
+type Provider struct {
+	lease.Clock
+
+	client  Client
+	table   string
+	ttlAttr string // if non-empty, also write the expiration time (in seconds) to this attribute
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new DynamoDB lease provider using the given client and table.
+// The table must already exist, with a string partition key named "name";
+// see [CreateTable].
+func New(client Client, table string, opts ...Option) *Provider {
+	p := &Provider{
+		Clock:  lease.DefaultClock{},
+		client: client,
+		table:  table,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// WithTTLAttribute is an [Option] that makes the provider also store each lease's expiration time,
+// in seconds since the epoch,
+// in the attribute with the given name.
+// If DynamoDB's Time to Live feature is enabled on the table for that attribute,
+// DynamoDB eventually deletes leases that expire without being released.
+// (Deletion can lag expiration considerably,
+// but the provider does not rely on it.)
+func WithTTLAttribute(name string) Option {
+	return func(p *Provider) {
+		p.ttlAttr = name
+	}
+}
+
+// CreateTable creates a table suitable for [New] if it does not already exist,
+// waiting until it is active.
+// If ttlAttr is non-empty,
+// it also enables Time to Live on the table for that attribute;
+// see [WithTTLAttribute].
+func CreateTable(ctx context.Context, client *ddb.Client, table, ttlAttr string) error {
+	_, err := client.CreateTable(ctx, &ddb.CreateTableInput{
+		TableName: &table,
+		AttributeDefinitions: []types.AttributeDefinition{{
+			AttributeName: aws.String("name"),
+			AttributeType: types.ScalarAttributeTypeS,
+		}},
+		KeySchema: []types.KeySchemaElement{{
+			AttributeName: aws.String("name"),
+			KeyType:       types.KeyTypeHash,
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return errors.Wrapf(err, "creating table %s", table)
+	}
+
+	waiter := ddb.NewTableExistsWaiter(client)
+	if err := waiter.Wait(ctx, &ddb.DescribeTableInput{TableName: &table}, 5*time.Minute); err != nil {
+		return errors.Wrapf(err, "waiting for table %s", table)
+	}
+
+	if ttlAttr == "" {
+		return nil
+	}
+
+	_, err = client.UpdateTimeToLive(ctx, &ddb.UpdateTimeToLiveInput{
+		TableName: &table,
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: &ttlAttr,
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return errors.Wrapf(err, "enabling time to live on table %s", table)
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	secret := hex.EncodeToString(secretBytes[:])
+
+	item := map[string]types.AttributeValue{
+		"name":   &types.AttributeValueMemberS{Value: name},
+		"secret": &types.AttributeValueMemberS{Value: secret},
+		"exp_ns": nanos(exp),
+	}
+	if p.ttlAttr != "" {
+		item[p.ttlAttr] = secs(exp)
+	}
+
+	_, err := p.client.PutItem(ctx, &ddb.PutItemInput{
+		TableName:           &p.table,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#name) OR exp_ns < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "name", // "name" is a reserved word in DynamoDB expressions
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": nanos(p.Now()),
+		},
+	})
+	if isConditionFailed(err) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, exp, nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var (
+		update = "SET exp_ns = :exp"
+		names  map[string]string
+		values = map[string]types.AttributeValue{
+			":exp":    nanos(exp),
+			":secret": &types.AttributeValueMemberS{Value: secret},
+			":now":    nanos(p.Now()),
+		}
+	)
+	if p.ttlAttr != "" {
+		update += ", #ttl = :ttl"
+		names = map[string]string{"#ttl": p.ttlAttr}
+		values[":ttl"] = secs(exp)
+	}
+
+	_, err := p.client.UpdateItem(ctx, &ddb.UpdateItemInput{
+		TableName:                 &p.table,
+		Key:                       key(name),
+		UpdateExpression:          &update,
+		ConditionExpression:       aws.String("secret = :secret AND exp_ns > :now"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if isConditionFailed(err) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return exp, nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	_, err := p.client.DeleteItem(ctx, &ddb.DeleteItemInput{
+		TableName:           &p.table,
+		Key:                 key(name),
+		ConditionExpression: aws.String("secret = :secret"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":secret": &types.AttributeValueMemberS{Value: secret},
+		},
+	})
+	if isConditionFailed(err) {
+		return lease.ErrNotHeld
+	}
+	return errors.Wrapf(err, "releasing lease %s", name)
+}
+
+func isConditionFailed(err error) bool {
+	var ccf *types.ConditionalCheckFailedException
+	return errors.As(err, &ccf)
+}
+
+func key(name string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"name": &types.AttributeValueMemberS{Value: name},
+	}
+}
+
+func nanos(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.UnixNano(), 10)}
+}
+
+func secs(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
@@ -0,0 +1,63 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	ddb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(client *ddb.Client, table string, opts ...Option) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(client, table, append(opts, WithClock(clock))...), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+
+	withTable(ctx, t, func(client *ddb.Client, table string) {
+		testutil.Provider(ctx, t, factory(client, table))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	ctx := context.Background()
+
+	withTable(ctx, t, func(client *ddb.Client, table string) {
+		testutil.Leader(ctx, t, factory(client, table, WithTTLAttribute("ttl")))
+	})
+}
+
+// withTable calls f with a client for DynamoDB Local
+// (or another DynamoDB-compatible endpoint)
+// and a newly created table.
+func withTable(ctx context.Context, t *testing.T, f func(*ddb.Client, string)) {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT must be set")
+	}
+
+	client := ddb.New(ddb.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("test", "test", ""),
+		BaseEndpoint: aws.String(endpoint),
+	})
+
+	table := fmt.Sprintf("leases_%d", time.Now().UnixNano())
+
+	if err := CreateTable(ctx, client, table, "ttl"); err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteTable(ctx, &ddb.DeleteTableInput{TableName: &table})
+
+	f(client, table)
+}
@@ -0,0 +1,314 @@
+// Package etcd implements [lease.Provider] in terms of an etcd v3 cluster.
+package etcd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/bobg/errors"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Provider is a lease.Provider implemented in terms of an etcd v3 cluster.
+//
+// Each lease is stored under its own key,
+// attached to an etcd lease whose TTL covers the lease's lifetime,
+// so that etcd deletes the keys of holders that disappear.
+// Acquiring, renewing, and releasing are done with transactions
+// comparing the key's create or mod revision
+// against the one observed,
+// so concurrent callers cannot overwrite each other's changes.
+//
+// Expiration is decided according to the provider's clock (see [WithClock]),
+// not etcd's lease TTLs,
+// which are only a backstop for cleanup.
+type Provider struct {
+	lease.Clock
+
+	client *clientv3.Client
+	prefix string
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new etcd lease provider using the given client.
+func New(client *clientv3.Client, opts ...Option) *Provider {
+	p := &Provider{
+		Clock:  lease.DefaultClock{},
+		client: client,
+		prefix: DefaultPrefix,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// DefaultPrefix is the key prefix for leases
+// unless overridden with [WithPrefix].
+const DefaultPrefix = "lease/"
+
+// WithPrefix is an [Option] that sets the prefix of the etcd keys in which leases are stored.
+// The key for a lease is the prefix followed by the lease name.
+func WithPrefix(prefix string) Option {
+	return func(p *Provider) {
+		p.prefix = prefix
+	}
+}
+
+// record is the JSON-encoded value stored under a lease's key.
+type record struct {
+	Secret  string           `json:"secret"`
+	Exp     time.Time        `json:"exp"`
+	LeaseID clientv3.LeaseID `json:"lease_id"` // the etcd lease to which the key is attached
+	TTL     int64            `json:"ttl"`      // the etcd lease's granted TTL in seconds
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	key := p.prefix + name
+
+	resp, err := p.client.Get(ctx, key)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if len(resp.Kvs) > 0 {
+		kv := resp.Kvs[0]
+
+		var rec record
+		if err := json.Unmarshal(kv.Value, &rec); err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "decoding lease %s", name)
+		}
+		if rec.Exp.After(p.Now()) {
+			return "", time.Time{}, lease.ErrHeld
+		}
+
+		// The lease has expired.
+		// Delete its key (unless someone else has changed it in the meantime)
+		// so the new holder's key gets a new create revision, for fencing.
+		_, err := p.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpDelete(key)).
+			Commit()
+		if err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "deleting expired lease %s", name)
+		}
+		_, _ = p.client.Revoke(ctx, rec.LeaseID)
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	secret := hex.EncodeToString(secretBytes[:])
+
+	rec, err := p.grant(ctx, secret, exp)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "granting etcd lease for %s", name)
+	}
+	val, err := json.Marshal(rec)
+	if err != nil {
+		p.revoke(ctx, rec.LeaseID)
+		return "", time.Time{}, errors.Wrapf(err, "encoding lease %s", name)
+	}
+
+	txnResp, err := p.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(val), clientv3.WithLease(rec.LeaseID))).
+		Commit()
+	if err != nil {
+		p.revoke(ctx, rec.LeaseID)
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+	if !txnResp.Succeeded {
+		p.revoke(ctx, rec.LeaseID)
+		return "", time.Time{}, lease.ErrHeld
+	}
+
+	return secret, exp, nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	key := p.prefix + name
+
+	kv, rec, err := p.get(ctx, key, secret)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if kv == nil || !rec.Exp.After(p.Now()) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	newRec := rec
+	newRec.Exp = exp
+
+	if ttlFor(p.Now(), exp) <= rec.TTL {
+		// The etcd lease's original TTL is long enough.
+		// A keepalive resets it.
+		if _, err := p.client.KeepAliveOnce(ctx, rec.LeaseID); err != nil {
+			return time.Time{}, errors.Wrapf(err, "keeping etcd lease for %s alive", name)
+		}
+	} else {
+		newRec, err = p.grant(ctx, secret, exp)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "granting etcd lease for %s", name)
+		}
+	}
+
+	// If the key does not end up attached to a newly granted etcd lease,
+	// revoke that lease rather than leave it to run out its TTL.
+	replaced := false
+	if newRec.LeaseID != rec.LeaseID {
+		defer func() {
+			if replaced {
+				p.revoke(ctx, rec.LeaseID)
+			} else {
+				p.revoke(ctx, newRec.LeaseID)
+			}
+		}()
+	}
+
+	val, err := json.Marshal(newRec)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "encoding lease %s", name)
+	}
+
+	txnResp, err := p.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+		Then(clientv3.OpPut(key, string(val), clientv3.WithLease(newRec.LeaseID))).
+		Commit()
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	if !txnResp.Succeeded {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	replaced = true
+
+	return exp, nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	key := p.prefix + name
+
+	kv, rec, err := p.get(ctx, key, secret)
+	if err != nil {
+		return errors.Wrapf(err, "getting lease %s", name)
+	}
+	if kv == nil {
+		return lease.ErrNotHeld
+	}
+
+	txnResp, err := p.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return errors.Wrapf(err, "releasing lease %s", name)
+	}
+	if !txnResp.Succeeded {
+		return lease.ErrNotHeld
+	}
+
+	_, _ = p.client.Revoke(ctx, rec.LeaseID)
+
+	return nil
+}
+
+// Fence returns a fencing token for the lease with the given name and secret:
+// the etcd create revision of its key.
+// The token increases every time the lease changes hands,
+// so a resource guarded by the lease can reject requests bearing a token
+// lower than the highest it has seen.
+//
+// Fence returns [lease.ErrNotHeld] if the lease is not held by the caller.
+func (p *Provider) Fence(ctx context.Context, name, secret string) (int64, error) {
+	kv, rec, err := p.get(ctx, p.prefix+name, secret)
+	if err != nil {
+		return 0, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if kv == nil || !rec.Exp.After(p.Now()) {
+		return 0, lease.ErrNotHeld
+	}
+	return kv.CreateRevision, nil
+}
+
+// get returns the key-value pair and decoded record for the given key,
+// or a nil key-value pair if the key does not exist or its secret does not match.
+func (p *Provider) get(ctx context.Context, key, secret string) (*mvccpb.KeyValue, record, error) {
+	var rec record
+
+	resp, err := p.client.Get(ctx, key)
+	if err != nil {
+		return nil, rec, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, rec, nil
+	}
+	if err := json.Unmarshal(resp.Kvs[0].Value, &rec); err != nil {
+		return nil, rec, errors.Wrap(err, "decoding lease")
+	}
+	if rec.Secret != secret {
+		return nil, rec, nil
+	}
+	return resp.Kvs[0], rec, nil
+}
+
+// grant grants an etcd lease long enough to outlive the given expiration time,
+// and returns a record for it.
+func (p *Provider) grant(ctx context.Context, secret string, exp time.Time) (record, error) {
+	resp, err := p.client.Grant(ctx, ttlFor(p.Now(), exp))
+	if err != nil {
+		return record{}, err
+	}
+	return record{
+		Secret:  secret,
+		Exp:     exp,
+		LeaseID: resp.ID,
+		TTL:     resp.TTL,
+	}, nil
+}
+
+// revokeTimeout bounds the time spent revoking an etcd lease that is no longer needed.
+const revokeTimeout = 5 * time.Second
+
+// revoke revokes the given etcd lease, ignoring errors.
+// It does so even if ctx is canceled,
+// since that is often why the caller is giving up on the lease.
+func (p *Provider) revoke(ctx context.Context, id clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), revokeTimeout)
+	defer cancel()
+	_, _ = p.client.Revoke(ctx, id)
+}
+
+// ttlFor returns the etcd lease TTL in seconds needed to cover the time from now until exp.
+func ttlFor(now, exp time.Time) int64 {
+	ttl := int64(exp.Sub(now)+time.Second-1) / int64(time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	return ttl
+}
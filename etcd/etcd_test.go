@@ -0,0 +1,178 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(client *clientv3.Client, prefix string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(client, WithClock(clock), WithPrefix(prefix)), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	withClient(t, func(client *clientv3.Client) {
+		testutil.Provider(context.Background(), t, factory(client, "provider/"))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	withClient(t, func(client *clientv3.Client) {
+		testutil.Leader(context.Background(), t, factory(client, "leader/"))
+	})
+}
+
+func TestFence(t *testing.T) {
+	ctx := context.Background()
+
+	withClient(t, func(client *clientv3.Client) {
+		p := New(client)
+
+		secret1, _, err := p.Acquire(ctx, "fence", time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fence1, err := p.Fence(ctx, "fence", secret1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Release(ctx, "fence", secret1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Fence(ctx, "fence", secret1); !errors.Is(err, lease.ErrNotHeld) {
+			t.Errorf("got error %v, want ErrNotHeld", err)
+		}
+
+		secret2, _, err := p.Acquire(ctx, "fence", time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Release(ctx, "fence", secret2)
+
+		fence2, err := p.Fence(ctx, "fence", secret2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fence2 <= fence1 {
+			t.Errorf("got fencing token %d after %d, want an increase", fence2, fence1)
+		}
+	})
+}
+
+func TestRenewTxnError(t *testing.T) {
+	withClient(t, func(client *clientv3.Client) {
+		ctx := context.Background()
+
+		p := New(client)
+		secret, _, err := p.Acquire(ctx, "txnerr", time.Now().Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Renewing for much longer than the etcd lease's TTL grants a new etcd lease,
+		// which must be revoked when the transaction attaching it fails.
+		kv := client.KV
+		client.KV = failingKV{KV: kv}
+		_, err = p.Renew(ctx, "txnerr", secret, time.Now().Add(time.Hour))
+		client.KV = kv
+		if !errors.Is(err, errTxn) {
+			t.Fatalf("got error %v, want %v", err, errTxn)
+		}
+
+		resp, err := client.Leases(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Leases) != 1 {
+			t.Errorf("got %d etcd leases, want 1", len(resp.Leases))
+		}
+	})
+}
+
+var errTxn = errors.New("txn failed")
+
+// failingKV is a [clientv3.KV] whose transactions fail.
+type failingKV struct {
+	clientv3.KV
+}
+
+func (k failingKV) Txn(ctx context.Context) clientv3.Txn {
+	return failingTxn{Txn: k.KV.Txn(ctx)}
+}
+
+type failingTxn struct {
+	clientv3.Txn
+}
+
+func (t failingTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	return failingTxn{Txn: t.Txn.If(cs...)}
+}
+
+func (t failingTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	return failingTxn{Txn: t.Txn.Then(ops...)}
+}
+
+func (failingTxn) Commit() (*clientv3.TxnResponse, error) {
+	return nil, errTxn
+}
+
+func withClient(t *testing.T, f func(*clientv3.Client)) {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	var (
+		clientURL = freeURL(t)
+		peerURL   = freeURL(t)
+	)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for etcd server")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	f(client)
+}
+
+func freeURL(t *testing.T) url.URL {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return url.URL{Scheme: "http", Host: ln.Addr().String()}
+}
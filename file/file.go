@@ -0,0 +1,209 @@
+// Package file implements [lease.Provider] in terms of files in a local directory,
+// for coordinating processes on a single host.
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Provider is a lease.Provider implemented in terms of files in a local directory.
+//
+// Each lease is stored in its own file,
+// named for the hex encoding of the lease name
+// (so that every name, including "", ".", and "..", maps to a file inside the directory),
+// holding the lease's secret and expiration time,
+// which is replaced atomically (by writing a temporary file and renaming it)
+// whenever the lease changes.
+// Changes are serialized across processes by an exclusive flock(2) on a companion lock file.
+// Lock files are never removed,
+// since doing so safely would require a lock of its own.
+//
+// File locking is supported only on Unix-like systems.
+type Provider struct {
+	lease.Clock
+
+	dir string
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new file-based lease provider storing leases in the given directory,
+// which is created if it does not already exist.
+func New(dir string, opts ...Option) (*Provider, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrapf(err, "creating directory %s", dir)
+	}
+
+	p := &Provider{
+		Clock: lease.DefaultClock{},
+		dir:   dir,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// record is the JSON-encoded content of a lease file.
+type record struct {
+	Secret string    `json:"secret"`
+	Exp    time.Time `json:"exp"`
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	secret := hex.EncodeToString(secretBytes[:])
+
+	err := p.withLock(name, func(path string) error {
+		rec, ok, err := readRecord(path)
+		if err != nil {
+			return err
+		}
+		if ok && rec.Exp.After(p.Now()) {
+			return lease.ErrHeld
+		}
+		return writeRecord(path, record{Secret: secret, Exp: exp})
+	})
+	if errors.Is(err, lease.ErrHeld) {
+		return "", time.Time{}, err
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, exp, nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	err := p.withLock(name, func(path string) error {
+		rec, ok, err := readRecord(path)
+		if err != nil {
+			return err
+		}
+		if !ok || rec.Secret != secret || !rec.Exp.After(p.Now()) {
+			return lease.ErrNotHeld
+		}
+		rec.Exp = exp
+		return writeRecord(path, rec)
+	})
+	if errors.Is(err, lease.ErrNotHeld) {
+		return time.Time{}, err
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return exp, nil
+}
+
+func (p *Provider) Release(_ context.Context, name, secret string) error {
+	err := p.withLock(name, func(path string) error {
+		rec, ok, err := readRecord(path)
+		if err != nil {
+			return err
+		}
+		if !ok || rec.Secret != secret {
+			return lease.ErrNotHeld
+		}
+		return os.Remove(path)
+	})
+	if errors.Is(err, lease.ErrNotHeld) {
+		return err
+	}
+	return errors.Wrapf(err, "releasing lease %s", name)
+}
+
+// withLock calls f with the path of the lease file for the given name
+// while holding the exclusive lock on its lock file.
+func (p *Provider) withLock(name string, f func(string) error) error {
+	base := filepath.Join(p.dir, "l-"+hex.EncodeToString([]byte(name)))
+
+	lockFile, err := os.OpenFile(base+".lock", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "opening lock file")
+	}
+	defer lockFile.Close()
+
+	if err := lock(lockFile); err != nil {
+		return errors.Wrap(err, "locking")
+	}
+	defer unlock(lockFile)
+
+	return f(base + ".lease")
+}
+
+// readRecord reads the lease file at the given path.
+// Its boolean result is false if the file does not exist.
+func readRecord(path string) (record, bool, error) {
+	var rec record
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rec, false, nil
+	}
+	if err != nil {
+		return rec, false, errors.Wrap(err, "reading lease file")
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, false, errors.Wrapf(err, "decoding lease file %s", path)
+	}
+	return rec, true, nil
+}
+
+// writeRecord atomically replaces the lease file at the given path.
+func writeRecord(path string, rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encoding lease file")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary file")
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "writing temporary file")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "syncing temporary file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "closing temporary file")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), path), "renaming temporary file")
+}
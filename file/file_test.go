@@ -0,0 +1,97 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(dir string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(dir, WithClock(clock))
+	}
+}
+
+func TestProvider(t *testing.T) {
+	testutil.Provider(context.Background(), t, factory(t.TempDir()))
+}
+
+func TestLeader(t *testing.T) {
+	testutil.Leader(context.Background(), t, factory(t.TempDir()))
+}
+
+func TestNames(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		parent = t.TempDir()
+		dir    = filepath.Join(parent, "leases")
+		exp    = time.Now().Add(time.Minute)
+	)
+
+	p, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"", ".", "..", "../..", "/", "a/b", "a%2Fb"}
+	for _, name := range names {
+		if _, _, err := p.Acquire(ctx, name, exp); err != nil {
+			t.Fatalf("acquiring %q: %s", name, err)
+		}
+	}
+
+	// Each name is a distinct lease.
+	for _, name := range names {
+		if _, _, err := p.Acquire(ctx, name, exp); !errors.Is(err, lease.ErrHeld) {
+			t.Errorf("reacquiring %q: got error %v, want ErrHeld", name, err)
+		}
+	}
+
+	// Nothing was written outside the lease directory.
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "leases" {
+		t.Errorf("got entries %v in parent directory, want only leases", entries)
+	}
+}
+
+func TestShared(t *testing.T) {
+	var (
+		ctx = context.Background()
+		dir = t.TempDir()
+		exp = time.Now().Add(time.Minute)
+	)
+
+	p1, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const name = "../weird/name"
+
+	secret, _, err := p1.Acquire(ctx, name, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p2.Acquire(ctx, name, exp); !errors.Is(err, lease.ErrHeld) {
+		t.Errorf("got error %v, want ErrHeld", err)
+	}
+	if err := p2.Release(ctx, name, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p2.Acquire(ctx, name, exp); err != nil {
+		t.Errorf("acquiring released lease: %s", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package file
+
+import (
+	"os"
+
+	"github.com/bobg/errors"
+)
+
+func lock(*os.File) error {
+	return errors.ErrUnsupported
+}
+
+func unlock(*os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,301 @@
+// Package grpcclient implements [lease.Provider] as a client of the gRPC Lease service
+// defined in github.com/bobg/lease/v2/leasepb
+// and implemented in github.com/bobg/lease/v2/grpcserver.
+package grpcclient
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/bobg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/acl"
+	"github.com/bobg/lease/v2/internal/deadline"
+	"github.com/bobg/lease/v2/leasepb"
+)
+
+// Client is a lease.Provider implemented as a client of the gRPC Lease service.
+//
+// The holder identity in the context of each call (see [lease.WithHolder])
+// is sent to the server,
+// which passes it on to its provider.
+//
+// Expiration times are computed by callers according to the client's clock (see [WithClock])
+// but enforced by the server's provider according to its own,
+// so the two should agree.
+// To avoid depending on that,
+// use [Client.AcquireTTL] and [Client.RenewTTL],
+// which send durations for the server to measure.
+type Client struct {
+	lease.Clock
+
+	client leasepb.LeaseClient
+	token  string
+}
+
+var (
+	_ lease.Provider    = &Client{}
+	_ lease.Waiter      = &Client{}
+	_ lease.Historian   = &Client{}
+	_ lease.Breaker     = &Client{}
+	_ lease.TTLProvider = &Client{}
+)
+
+// New creates a new Client using the given connection.
+func New(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	c := &Client{
+		Clock:  lease.DefaultClock{},
+		client: leasepb.NewLeaseClient(conn),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Client)
+
+// WithClock is an [Option] that sets the clock used by the client.
+func WithClock(clock lease.Clock) Option {
+	return func(c *Client) {
+		c.Clock = clock
+	}
+}
+
+// WithToken is an [Option] that sets a bearer token to send with each call.
+// See [github.com/bobg/lease/v2/grpcserver.WithAuthenticator].
+//
+// Alternatively, dial the server with [grpc.WithPerRPCCredentials].
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func (c *Client) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	resp, err := c.client.Acquire(c.outgoing(ctx), &leasepb.AcquireRequest{
+		Name:   name,
+		Exp:    leasepb.Timestamp(exp),
+		Holder: lease.Holder(ctx),
+	})
+	if err != nil {
+		return "", time.Time{}, fromStatus(err, "acquiring lease %s", name)
+	}
+	if resp.GetExp() == nil {
+		return "", time.Time{}, errors.Wrapf(ErrNoExp, "acquiring lease %s", name)
+	}
+	return resp.GetSecret(), resp.GetExp().AsTime(), nil
+}
+
+// AcquireWait implements [lease.Waiter]
+// using the Wait RPC.
+func (c *Client) AcquireWait(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	stream, err := c.client.Wait(c.outgoing(ctx), &leasepb.AcquireRequest{
+		Name:   name,
+		Exp:    leasepb.Timestamp(exp),
+		Holder: lease.Holder(ctx),
+	})
+	if err != nil {
+		return "", time.Time{}, fromStatus(err, "waiting for lease %s", name)
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return "", time.Time{}, errors.Errorf("stream ended while waiting for lease %s", name)
+		}
+		if err != nil {
+			return "", time.Time{}, fromStatus(err, "waiting for lease %s", name)
+		}
+		if secret := resp.GetSecret(); secret != "" {
+			if resp.GetExp() == nil {
+				return "", time.Time{}, errors.Wrapf(ErrNoExp, "waiting for lease %s", name)
+			}
+			return secret, resp.GetExp().AsTime(), nil
+		}
+	}
+}
+
+func (c *Client) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	resp, err := c.client.Renew(c.outgoing(ctx), &leasepb.RenewRequest{
+		Name:   name,
+		Secret: secret,
+		Exp:    leasepb.Timestamp(exp),
+		Holder: lease.Holder(ctx),
+	})
+	if err != nil {
+		return time.Time{}, fromStatus(err, "renewing lease %s", name)
+	}
+	if resp.GetExp() == nil {
+		return time.Time{}, errors.Wrapf(ErrNoExp, "renewing lease %s", name)
+	}
+	return resp.GetExp().AsTime(), nil
+}
+
+// AcquireTTL implements [lease.TTLProvider]
+// using the Acquire RPC with a ttl.
+// The server measures the duration,
+// passing it on to its provider if that is a [lease.TTLProvider] too.
+func (c *Client) AcquireTTL(ctx context.Context, name string, ttl time.Duration) (string, time.Time, error) {
+	ttl, err := deadline.ClampTTL(ctx, c.Clock, ttl)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	resp, err := c.client.Acquire(c.outgoing(ctx), &leasepb.AcquireRequest{
+		Name:   name,
+		Ttl:    durationpb.New(ttl),
+		Holder: lease.Holder(ctx),
+	})
+	if err != nil {
+		return "", time.Time{}, fromStatus(err, "acquiring lease %s", name)
+	}
+	if resp.GetExp() == nil {
+		return "", time.Time{}, errors.Wrapf(ErrNoExp, "acquiring lease %s", name)
+	}
+	return resp.GetSecret(), resp.GetExp().AsTime(), nil
+}
+
+// RenewTTL implements [lease.TTLProvider]
+// using the Renew RPC with a ttl.
+// The server measures the duration,
+// passing it on to its provider if that is a [lease.TTLProvider] too.
+func (c *Client) RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error) {
+	ttl, err := deadline.ClampTTL(ctx, c.Clock, ttl)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+
+	resp, err := c.client.Renew(c.outgoing(ctx), &leasepb.RenewRequest{
+		Name:   name,
+		Secret: secret,
+		Ttl:    durationpb.New(ttl),
+		Holder: lease.Holder(ctx),
+	})
+	if err != nil {
+		return time.Time{}, fromStatus(err, "renewing lease %s", name)
+	}
+	if resp.GetExp() == nil {
+		return time.Time{}, errors.Wrapf(ErrNoExp, "renewing lease %s", name)
+	}
+	return resp.GetExp().AsTime(), nil
+}
+
+// ErrNoExp is the error for a response from the server
+// that lacks the effective expiration time of a lease it granted or renewed.
+var ErrNoExp = errors.New("no expiration time in server response")
+
+func (c *Client) Release(ctx context.Context, name, secret string) error {
+	_, err := c.client.Release(c.outgoing(ctx), &leasepb.ReleaseRequest{
+		Name:   name,
+		Secret: secret,
+		Holder: lease.Holder(ctx),
+	})
+	return fromStatus(err, "releasing lease %s", name)
+}
+
+// Break implements [lease.Breaker]
+// using the Break RPC.
+func (c *Client) Break(ctx context.Context, name, reason string) error {
+	_, err := c.client.Break(c.outgoing(ctx), &leasepb.BreakRequest{
+		Name:   name,
+		Reason: reason,
+		Holder: lease.Holder(ctx),
+	})
+	return fromStatus(err, "breaking lease %s", name)
+}
+
+// History implements [lease.Historian]
+// using the audit trail kept by the server's provider, if any.
+func (c *Client) History(ctx context.Context, hq lease.HistoryQuery) ([]lease.Event, error) {
+	resp, err := c.client.History(c.outgoing(ctx), &leasepb.HistoryRequest{
+		Name:  hq.Name,
+		Since: leasepb.Timestamp(hq.Since),
+		Until: leasepb.Timestamp(hq.Until),
+	})
+	if err != nil {
+		return nil, fromStatus(err, "getting history")
+	}
+
+	var result []lease.Event
+	for _, ev := range resp.GetEvents() {
+		result = append(result, ev.LeaseEvent())
+	}
+	return result, nil
+}
+
+// Watch calls f for each event the server reports
+// for the lease with the given name,
+// or for all leases if name is empty.
+// It runs until the context is canceled or f returns an error.
+//
+// See [github.com/bobg/lease/v2/grpcserver.Server] for which events are reported.
+func (c *Client) Watch(ctx context.Context, name string, f func(lease.Event) error) error {
+	stream, err := c.client.Watch(c.outgoing(ctx), &leasepb.WatchRequest{Name: name})
+	if err != nil {
+		return fromStatus(err, "watching leases")
+	}
+
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			return fromStatus(err, "watching leases")
+		}
+		if err := f(ev.LeaseEvent()); err != nil {
+			return err
+		}
+	}
+}
+
+// outgoing adds the client's token, if any, to the metadata of an outgoing call.
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
+
+// fromStatus converts a gRPC status error from the server
+// to the error a [lease.Provider] would return.
+func fromStatus(err error, format string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.AlreadyExists:
+		return lease.ErrHeld
+	case codes.FailedPrecondition:
+		return lease.ErrNotHeld
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.PermissionDenied:
+		return errors.Wrapf(acl.ErrDenied, format, args...)
+	case codes.Unauthenticated:
+		return errors.Wrapf(acl.ErrUnauthenticated, format, args...)
+	case codes.Unimplemented:
+		return errors.Wrapf(errors.ErrUnsupported, format, args...)
+	}
+	return errors.Wrapf(err, format, args...)
+}
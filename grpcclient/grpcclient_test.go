@@ -0,0 +1,238 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/grpcserver"
+	"github.com/bobg/lease/v2/leasepb"
+	"github.com/bobg/lease/v2/mem"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+// factory produces clients of a server wrapping a new mem.Provider
+// that uses the same clock.
+func factory(t *testing.T, opts ...mem.Option) testutil.Factory {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New(opts...)
+		p.Clock = clock
+		return New(dial(t, p), WithClock(clock)), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	testutil.Provider(context.Background(), t, factory(t))
+}
+
+func TestLeader(t *testing.T) {
+	testutil.Leader(context.Background(), t, factory(t))
+}
+
+func TestTTLProvider(t *testing.T) {
+	testutil.TTLProvider(context.Background(), t, factory(t))
+}
+
+func TestHistory(t *testing.T) {
+	// The holder identity passes through to the server's provider.
+	testutil.History(context.Background(), t, factory(t, mem.WithHistory(10)))
+}
+
+func TestBreaker(t *testing.T) {
+	testutil.Breaker(context.Background(), t, factory(t, mem.WithHistory(20)))
+}
+
+func TestAcquireWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	p := mem.New()
+	p.Clock = mockClock
+	c := New(dial(t, p), WithClock(mockClock))
+
+	type result struct {
+		secret string
+		err    error
+	}
+	wait := func(name string) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			secret, _, err := c.AcquireWait(ctx, name, t0.Add(time.Hour))
+			ch <- result{secret: secret, err: err}
+		}()
+		return ch
+	}
+
+	// Waking on release.
+
+	secret, _, err := c.Acquire(ctx, "test", t0.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := wait("test")
+
+	select {
+	case r := <-ch:
+		t.Fatalf("AcquireWait returned (%q, %v) while the lease was held", r.secret, r.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := c.Release(ctx, "test", secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := <-ch; r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	// Waking on expiry.
+
+	if _, _, err := c.Acquire(ctx, "test2", t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	ch = wait("test2")
+
+	time.Sleep(100 * time.Millisecond) // let the waiter find the lease held
+	mockClock.Add(2 * time.Minute)
+
+	if r := <-ch; r.err != nil {
+		t.Fatal(r.err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	p := mem.New()
+	p.Clock = mockClock
+	c := New(dial(t, p), WithClock(mockClock))
+
+	events := make(chan lease.Event)
+	go c.Watch(ctx, "test", func(ev lease.Event) error {
+		events <- ev
+		return nil
+	})
+	time.Sleep(100 * time.Millisecond) // let the watch start
+
+	next := func(want lease.EventType) {
+		t.Helper()
+
+		select {
+		case ev := <-events:
+			if ev.Name != "test" || ev.Type != want {
+				t.Fatalf("got event %+v, want %s of test", ev, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s event", want)
+		}
+	}
+
+	holder := lease.WithHolder(ctx, "alice")
+
+	secret, _, err := c.Acquire(holder, "test", t0.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(lease.EventAcquire)
+
+	if _, _, err := c.Acquire(holder, "other", t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Renew(holder, "test", secret, t0.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	next(lease.EventRenew)
+
+	if err := c.Release(holder, "test", secret); err != nil {
+		t.Fatal(err)
+	}
+	next(lease.EventRelease)
+
+	if _, _, err := c.Acquire(holder, "test", t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	next(lease.EventAcquire)
+
+	mockClock.Add(2 * time.Minute)
+	next(lease.EventExpire)
+}
+
+// noExp is a server that leaves the expiration times out of its responses.
+type noExp struct {
+	leasepb.UnimplementedLeaseServer
+}
+
+func (noExp) Acquire(context.Context, *leasepb.AcquireRequest) (*leasepb.AcquireResponse, error) {
+	return &leasepb.AcquireResponse{Secret: "secret"}, nil
+}
+
+func (noExp) Renew(context.Context, *leasepb.RenewRequest) (*leasepb.RenewResponse, error) {
+	return &leasepb.RenewResponse{}, nil
+}
+
+func TestNoExp(t *testing.T) {
+	var (
+		ctx = context.Background()
+		c   = New(dialServer(t, noExp{}))
+		exp = time.Now().Add(time.Minute)
+	)
+
+	if _, _, err := c.Acquire(ctx, "test", exp); !errors.Is(err, ErrNoExp) {
+		t.Errorf("got error %v from Acquire, want ErrNoExp", err)
+	}
+	if _, err := c.Renew(ctx, "test", "secret", exp); !errors.Is(err, ErrNoExp) {
+		t.Errorf("got error %v from Renew, want ErrNoExp", err)
+	}
+}
+
+// dial starts an in-process server wrapping p
+// and returns a connection to it.
+func dial(t *testing.T, p lease.Provider) *grpc.ClientConn {
+	return dialServer(t, grpcserver.New(p))
+}
+
+// dialServer starts an in-process server with the given implementation
+// and returns a connection to it.
+func dialServer(t *testing.T, srv leasepb.LeaseServer) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+
+	gs := grpc.NewServer()
+	leasepb.RegisterLeaseServer(gs, srv)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
@@ -0,0 +1,623 @@
+// Package grpcserver implements the gRPC Lease service defined in github.com/bobg/lease/v2/leasepb
+// in terms of any [lease.Provider].
+//
+// This lets many programs, in any language, share leases
+// without each needing access to the provider's backing store.
+// A Go client is in github.com/bobg/lease/v2/grpcclient.
+package grpcserver
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bobg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/acl"
+	"github.com/bobg/lease/v2/leasepb"
+)
+
+// Server implements [leasepb.LeaseServer] in terms of a [lease.Provider].
+// Register it with a gRPC server using [leasepb.RegisterLeaseServer].
+//
+// The Watch RPC reports the events that pass through the server:
+// the leases it acquires, renews, releases, and breaks,
+// and the expiry of leases it acquired and that were not renewed or released through it.
+// Changes made to the provider's leases by other means are not reported.
+//
+// Requests may give a ttl instead of an expiration time.
+// If the provider is a [lease.TTLProvider],
+// the ttl is passed to it as such,
+// so the provider's clock alone determines the expiration time;
+// otherwise it is added to the current time by the provider's clock.
+//
+// The Wait RPC uses the provider's own waiting mechanism if it implements [lease.Waiter].
+// Otherwise the server retries when it sees the lease released or expired,
+// and also at a regular interval (see [WithPollInterval])
+// to notice changes made by other means.
+//
+// Callers may be authenticated with bearer tokens
+// (in "authorization: Bearer ..." metadata)
+// and verified TLS client certificates (see [WithAuthenticator]).
+// Combined with a provider from github.com/bobg/lease/v2/acl,
+// this controls who may do what with which leases.
+// The Watch RPC then reports only events for leases the caller may inspect,
+// as determined by the provider's [acl.Authorizer] implementation;
+// if the provider has none,
+// Watch fails with [codes.PermissionDenied] for servers with an authenticator.
+type Server struct {
+	leasepb.UnimplementedLeaseServer
+
+	p            lease.Provider
+	pollInterval time.Duration
+	auth         acl.Authenticator
+
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	granted  map[string]*grant // leases acquired through this server, by name
+}
+
+var _ leasepb.LeaseServer = &Server{}
+
+// New creates a new Server using the given provider.
+func New(p lease.Provider, opts ...Option) *Server {
+	s := &Server{
+		p:            p,
+		pollInterval: DefaultPollInterval,
+		watchers:     make(map[*watcher]struct{}),
+		granted:      make(map[string]*grant),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Server)
+
+// DefaultPollInterval is how often the Wait RPC retries acquiring a held lease
+// unless overridden with [WithPollInterval].
+const DefaultPollInterval = 5 * time.Second
+
+// WithPollInterval is an [Option] that sets how often the Wait RPC retries acquiring a held lease
+// when the provider does not implement [lease.Waiter].
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.pollInterval = d
+	}
+}
+
+// WithAuthenticator is an [Option] that authenticates each call with the given [acl.Authenticator],
+// placing the caller's identity in the call's context
+// (see [acl.WithIdentity])
+// for the provider to check.
+// Calls with bad credentials fail with [codes.Unauthenticated].
+// The caller's identity is also recorded as the holder of the leases it acquires, renews, and so on
+// (see [acl.Holder]);
+// calls naming a different holder fail with [codes.PermissionDenied].
+func WithAuthenticator(auth acl.Authenticator) Option {
+	return func(s *Server) {
+		s.auth = auth
+	}
+}
+
+type (
+	// grant is a lease acquired through the server.
+	grant struct {
+		secret string
+		exp    time.Time
+		holder string
+		stop   chan struct{} // closed to cancel the expiry timer
+	}
+
+	// watcher is a subscriber to events.
+	watcher struct {
+		name string // if non-empty, only events for the lease with this name
+		ch   chan lease.Event
+	}
+)
+
+// watcherBuffer is how many events a watcher may fall behind
+// before it is dropped.
+const watcherBuffer = 64
+
+func (s *Server) Acquire(ctx context.Context, req *leasepb.AcquireRequest) (*leasepb.AcquireResponse, error) {
+	if err := validate(req.GetName()); err != nil {
+		return nil, err
+	}
+	e, err := parseExpiry(req.GetExp(), req.GetTtl())
+	if err != nil {
+		return nil, err
+	}
+	ctx, err = s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, exp, err := s.acquire(ctx, req, e)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &leasepb.AcquireResponse{Secret: secret, Exp: leasepb.Timestamp(exp)}, nil
+}
+
+func (s *Server) acquire(ctx context.Context, req *leasepb.AcquireRequest, e expiry) (string, time.Time, error) {
+	name := req.GetName()
+	holder, err := acl.Holder(ctx, req.GetHolder())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	secret, exp, err := s.acquireFor(withHolder(ctx, holder), name, e)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	s.recordGrant(name, secret, exp, holder)
+	return secret, exp, nil
+}
+
+// acquireFor acquires the named lease until the expiration time given by e.
+// A ttl goes to the provider's AcquireTTL method if it is a [lease.TTLProvider].
+func (s *Server) acquireFor(ctx context.Context, name string, e expiry) (string, time.Time, error) {
+	if e.ttl > 0 {
+		if tp, ok := s.p.(lease.TTLProvider); ok {
+			secret, exp, err := tp.AcquireTTL(ctx, name, e.ttl)
+			if !errors.Is(err, errors.ErrUnsupported) {
+				return secret, exp, err
+			}
+			// Otherwise fall back to computing the expiration time here.
+		}
+		e.exp = s.p.Now().Add(e.ttl)
+	}
+	return s.p.Acquire(ctx, name, e.exp)
+}
+
+// renewFor renews the named lease until the expiration time given by e.
+// A ttl goes to the provider's RenewTTL method if it is a [lease.TTLProvider].
+func (s *Server) renewFor(ctx context.Context, name, secret string, e expiry) (time.Time, error) {
+	if e.ttl > 0 {
+		if tp, ok := s.p.(lease.TTLProvider); ok {
+			exp, err := tp.RenewTTL(ctx, name, secret, e.ttl)
+			if !errors.Is(err, errors.ErrUnsupported) {
+				return exp, err
+			}
+			// Otherwise fall back to computing the expiration time here.
+		}
+		e.exp = s.p.Now().Add(e.ttl)
+	}
+	return s.p.Renew(ctx, name, secret, e.exp)
+}
+
+func (s *Server) Renew(ctx context.Context, req *leasepb.RenewRequest) (*leasepb.RenewResponse, error) {
+	if err := validate(req.GetName()); err != nil {
+		return nil, err
+	}
+	e, err := parseExpiry(req.GetExp(), req.GetTtl())
+	if err != nil {
+		return nil, err
+	}
+	ctx, err = s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	holder, err := acl.Holder(ctx, req.GetHolder())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	var (
+		name   = req.GetName()
+		secret = req.GetSecret()
+	)
+
+	exp, err := s.renewFor(withHolder(ctx, holder), name, secret, e)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.track(name, secret, exp, holder)
+	s.publish(lease.Event{Name: name, Type: lease.EventRenew, Holder: holder, Time: s.p.Now(), Exp: exp})
+
+	return &leasepb.RenewResponse{Exp: leasepb.Timestamp(exp)}, nil
+}
+
+func (s *Server) Release(ctx context.Context, req *leasepb.ReleaseRequest) (*leasepb.ReleaseResponse, error) {
+	if err := validate(req.GetName()); err != nil {
+		return nil, err
+	}
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	holder, err := acl.Holder(ctx, req.GetHolder())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	var (
+		name   = req.GetName()
+		secret = req.GetSecret()
+	)
+
+	if err := s.p.Release(withHolder(ctx, holder), name, secret); err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g := s.granted[name]; g != nil && g.secret == secret {
+		close(g.stop)
+		delete(s.granted, name)
+	}
+	s.publish(lease.Event{Name: name, Type: lease.EventRelease, Holder: holder, Time: s.p.Now()})
+
+	return &leasepb.ReleaseResponse{}, nil
+}
+
+func (s *Server) Break(ctx context.Context, req *leasepb.BreakRequest) (*leasepb.BreakResponse, error) {
+	if err := validate(req.GetName()); err != nil {
+		return nil, err
+	}
+	b, ok := s.p.(lease.Breaker)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "provider cannot break leases")
+	}
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	holder, err := acl.Holder(ctx, req.GetHolder())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	var (
+		name   = req.GetName()
+		reason = req.GetReason()
+	)
+
+	if err := b.Break(withHolder(ctx, holder), name, reason); err != nil {
+		return nil, toStatus(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g := s.granted[name]; g != nil {
+		close(g.stop)
+		delete(s.granted, name)
+	}
+	s.publish(lease.Event{Name: name, Type: lease.EventBreak, Holder: holder, Time: s.p.Now(), Reason: reason})
+
+	return &leasepb.BreakResponse{}, nil
+}
+
+func (s *Server) Wait(req *leasepb.AcquireRequest, stream leasepb.Lease_WaitServer) error {
+	if err := validate(req.GetName()); err != nil {
+		return err
+	}
+	e, err := parseExpiry(req.GetExp(), req.GetTtl())
+	if err != nil {
+		return err
+	}
+
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	if w, ok := s.p.(lease.Waiter); ok {
+		holder, err := acl.Holder(ctx, req.GetHolder())
+		if err != nil {
+			return toStatus(err)
+		}
+
+		// A Waiter takes only an expiration time,
+		// so a ttl is measured from the start of the wait.
+		exp := e.exp
+		if e.ttl > 0 {
+			exp = s.p.Now().Add(e.ttl)
+		}
+
+		name := req.GetName()
+		secret, exp, err := w.AcquireWait(withHolder(ctx, holder), name, exp)
+		if err == nil {
+			s.recordGrant(name, secret, exp, holder)
+			return stream.Send(&leasepb.WaitResponse{Secret: secret, Exp: leasepb.Timestamp(exp)})
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return toStatus(err)
+		}
+		// Otherwise fall back to retrying.
+	}
+
+	// Subscribe first, so no release between an attempt and the wait for the next one can be missed.
+	w := s.subscribe(req.GetName())
+	defer s.unsubscribe(w)
+
+	events := w.ch
+
+	for {
+		secret, exp, err := s.acquire(ctx, req, e)
+		if err == nil {
+			return stream.Send(&leasepb.WaitResponse{Secret: secret, Exp: leasepb.Timestamp(exp)})
+		}
+		if !errors.Is(err, lease.ErrHeld) {
+			return toStatus(err)
+		}
+
+		if err := stream.Send(&leasepb.WaitResponse{}); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx.Err())
+
+		case _, ok := <-events:
+			if !ok {
+				// Dropped for falling behind.
+				// Carry on with polling alone.
+				events = nil
+			}
+
+		case <-s.p.After(s.pollInterval):
+		}
+	}
+}
+
+func (s *Server) History(ctx context.Context, req *leasepb.HistoryRequest) (*leasepb.HistoryResponse, error) {
+	h, ok := s.p.(lease.Historian)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "provider keeps no history")
+	}
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := h.History(ctx, lease.HistoryQuery{
+		Name:  req.GetName(),
+		Since: leasepb.Time(req.GetSince()),
+		Until: leasepb.Time(req.GetUntil()),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &leasepb.HistoryResponse{}
+	for _, ev := range events {
+		resp.Events = append(resp.Events, leasepb.FromEvent(ev))
+	}
+	return resp, nil
+}
+
+func (s *Server) Watch(req *leasepb.WatchRequest, stream leasepb.Lease_WatchServer) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	// The watcher's events bypass the provider,
+	// so check them against its rules, if any, here.
+	// Authenticated callers are restricted by definition,
+	// so without a way to apply the restrictions,
+	// fail rather than show them everything.
+	a, _ := s.p.(acl.Authorizer)
+	if a == nil && s.auth != nil {
+		return status.Error(codes.PermissionDenied, "provider cannot authorize watchers")
+	}
+	if a != nil && req.GetName() != "" {
+		if err := a.Check(ctx, req.GetName(), acl.Inspect); err != nil {
+			return toStatus(err)
+		}
+	}
+
+	w := s.subscribe(req.GetName())
+	defer s.unsubscribe(w)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx.Err())
+
+		case ev, ok := <-w.ch:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind")
+			}
+			if a != nil && a.Check(ctx, ev.Name, acl.Inspect) != nil {
+				continue
+			}
+			if err := stream.Send(leasepb.FromEvent(ev)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// recordGrant records a lease acquired through the server
+// and publishes the event.
+func (s *Server) recordGrant(name, secret string, exp time.Time, holder string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evtype := lease.EventAcquire
+	if s.granted[name] != nil {
+		// The previous holder's lease expired
+		// (though the server may not have noticed yet).
+		evtype = lease.EventTakeover
+	}
+
+	s.track(name, secret, exp, holder)
+	s.publish(lease.Event{Name: name, Type: evtype, Holder: holder, Time: s.p.Now(), Exp: exp})
+}
+
+// track records a grant for the named lease,
+// replacing and stopping any previous one,
+// and starts a timer to publish its expiry.
+// The caller must hold s.mu.
+func (s *Server) track(name, secret string, exp time.Time, holder string) {
+	if old := s.granted[name]; old != nil {
+		close(old.stop)
+	}
+
+	g := &grant{secret: secret, exp: exp, holder: holder, stop: make(chan struct{})}
+	s.granted[name] = g
+
+	timer := s.p.After(g.exp.Sub(s.p.Now()))
+
+	go func() {
+		select {
+		case <-g.stop:
+		case <-timer:
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			if s.granted[name] == g {
+				delete(s.granted, name)
+				s.publish(lease.Event{Name: name, Type: lease.EventExpire, Holder: g.holder, Time: s.p.Now(), Exp: g.exp})
+			}
+		}
+	}()
+}
+
+func (s *Server) subscribe(name string) *watcher {
+	w := &watcher{name: name, ch: make(chan lease.Event, watcherBuffer)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watchers[w] = struct{}{}
+	return w
+}
+
+func (s *Server) unsubscribe(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.watchers[w]; ok {
+		delete(s.watchers, w)
+		close(w.ch)
+	}
+}
+
+// publish sends ev to the interested watchers.
+// A watcher that has fallen too far behind is dropped,
+// closing its channel.
+// The caller must hold s.mu.
+func (s *Server) publish(ev lease.Event) {
+	for w := range s.watchers {
+		if w.name != "" && w.name != ev.Name {
+			continue
+		}
+		select {
+		case w.ch <- ev:
+		default:
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	}
+}
+
+// authenticate returns a context carrying the identity of the caller,
+// as determined by the server's authenticator, if any,
+// from the credentials in ctx.
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.auth == nil {
+		return ctx, nil
+	}
+
+	var creds acl.Credentials
+	for _, v := range metadata.ValueFromIncomingContext(ctx, "authorization") {
+		if token, ok := strings.CutPrefix(v, "Bearer "); ok {
+			creds.Token = token
+			break
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			creds.Certs = info.State.VerifiedChains[0]
+		}
+	}
+
+	identity, err := s.auth.Authenticate(ctx, creds)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return acl.WithIdentity(ctx, identity), nil
+}
+
+func withHolder(ctx context.Context, holder string) context.Context {
+	if holder == "" {
+		return ctx
+	}
+	return lease.WithHolder(ctx, holder)
+}
+
+func validate(name string) error {
+	if name == "" {
+		return status.Error(codes.InvalidArgument, "missing lease name")
+	}
+	return nil
+}
+
+// expiry is the expiration time given in a request,
+// either directly or as a duration from now.
+type expiry struct {
+	exp time.Time
+	ttl time.Duration // if positive, used instead of exp
+}
+
+// parseExpiry returns the expiry given by the exp and ttl fields of a request,
+// exactly one of which must be set.
+func parseExpiry(exp *timestamppb.Timestamp, ttl *durationpb.Duration) (expiry, error) {
+	switch {
+	case exp != nil && ttl != nil:
+		return expiry{}, status.Error(codes.InvalidArgument, "exp and ttl are mutually exclusive")
+	case exp != nil:
+		return expiry{exp: leasepb.Time(exp)}, nil
+	case ttl != nil:
+		d := ttl.AsDuration()
+		if d <= 0 {
+			return expiry{}, status.Errorf(codes.InvalidArgument, "ttl %s is not positive", d)
+		}
+		return expiry{ttl: d}, nil
+	default:
+		return expiry{}, status.Error(codes.InvalidArgument, "missing expiration time")
+	}
+}
+
+// toStatus converts an error from a provider to a gRPC status error.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, lease.ErrHeld):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, lease.ErrNotHeld):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, acl.ErrDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, errors.ErrUnsupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,275 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/acl"
+	"github.com/bobg/lease/v2/leasepb"
+	"github.com/bobg/lease/v2/mem"
+)
+
+// waiter is a lease.Waiter that records its calls.
+type waiter struct {
+	*mem.Provider
+	names []string
+}
+
+func (w *waiter) AcquireWait(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	w.names = append(w.names, name)
+	return w.Acquire(ctx, name, exp)
+}
+
+func TestWaiter(t *testing.T) {
+	ctx := context.Background()
+
+	w := &waiter{Provider: mem.New()}
+	client := dial(t, w)
+
+	stream, err := client.Wait(ctx, &leasepb.AcquireRequest{Name: "test", Exp: leasepb.Timestamp(time.Now().Add(time.Minute))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetSecret() == "" {
+		t.Error("got no secret")
+	}
+	if len(w.names) != 1 || w.names[0] != "test" {
+		t.Errorf("provider's AcquireWait called for %v, want [test]", w.names)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// The wrapper hides mem.Provider's History method.
+	client := dial(t, struct{ lease.Provider }{mem.New()})
+	exp := leasepb.Timestamp(time.Now().Add(time.Minute))
+
+	cases := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{{
+		name: "missing name",
+		call: func() error {
+			_, err := client.Acquire(ctx, &leasepb.AcquireRequest{Exp: exp})
+			return err
+		},
+		want: codes.InvalidArgument,
+	}, {
+		name: "missing exp",
+		call: func() error {
+			_, err := client.Acquire(ctx, &leasepb.AcquireRequest{Name: "test"})
+			return err
+		},
+		want: codes.InvalidArgument,
+	}, {
+		name: "held",
+		call: func() error {
+			if _, err := client.Acquire(ctx, &leasepb.AcquireRequest{Name: "held", Exp: exp}); err != nil {
+				return err
+			}
+			_, err := client.Acquire(ctx, &leasepb.AcquireRequest{Name: "held", Exp: exp})
+			return err
+		},
+		want: codes.AlreadyExists,
+	}, {
+		name: "not held",
+		call: func() error {
+			_, err := client.Release(ctx, &leasepb.ReleaseRequest{Name: "test", Secret: "bogus"})
+			return err
+		},
+		want: codes.FailedPrecondition,
+	}, {
+		name: "no history",
+		call: func() error {
+			_, err := client.History(ctx, &leasepb.HistoryRequest{})
+			return err
+		},
+		want: codes.Unimplemented,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := status.Code(tc.call()); got != tc.want {
+				t.Errorf("got code %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	var (
+		rules  = []acl.Rule{{Identity: "alice", Prefix: "alice/", Ops: acl.All}}
+		m      = mem.New(mem.WithHistory(100))
+		client = dial(t, acl.New(m, rules...), WithAuthenticator(acl.Tokens{"alicetoken": "alice"}))
+	)
+
+	exp := leasepb.Timestamp(time.Now().Add(time.Minute))
+
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	cases := []struct {
+		name  string
+		ctx   context.Context
+		lease string
+		want  codes.Code
+	}{{
+		name:  "anonymous",
+		ctx:   context.Background(),
+		lease: "alice/x",
+		want:  codes.PermissionDenied,
+	}, {
+		name:  "bad token",
+		ctx:   withToken("bogus"),
+		lease: "alice/x",
+		want:  codes.Unauthenticated,
+	}, {
+		name:  "wrong prefix",
+		ctx:   withToken("alicetoken"),
+		lease: "bob/x",
+		want:  codes.PermissionDenied,
+	}, {
+		name:  "ok",
+		ctx:   withToken("alicetoken"),
+		lease: "alice/x",
+		want:  codes.OK,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.Acquire(tc.ctx, &leasepb.AcquireRequest{Name: tc.lease, Exp: exp})
+			if got := status.Code(err); got != tc.want {
+				t.Errorf("got code %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("wait", func(t *testing.T) {
+		// The acl.Provider's AcquireWait is unsupported for a mem.Provider,
+		// so the server falls back to retrying.
+		stream, err := client.Wait(withToken("alicetoken"), &leasepb.AcquireRequest{Name: "alice/w", Exp: exp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetSecret() == "" {
+			t.Error("got no secret")
+		}
+	})
+
+	t.Run("holder", func(t *testing.T) {
+		ctx := withToken("alicetoken")
+
+		// Alice may not claim to be someone else.
+		_, err := client.Acquire(ctx, &leasepb.AcquireRequest{Name: "alice/h", Exp: exp, Holder: "bob"})
+		if got := status.Code(err); got != codes.PermissionDenied {
+			t.Errorf("got code %s acquiring as bob, want %s", got, codes.PermissionDenied)
+		}
+
+		// With no holder in the request, the holder is the caller's identity.
+		resp, err := client.Acquire(ctx, &leasepb.AcquireRequest{Name: "alice/h", Exp: exp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.Release(ctx, &leasepb.ReleaseRequest{Name: "alice/h", Secret: resp.GetSecret(), Holder: "bob"})
+		if got := status.Code(err); got != codes.PermissionDenied {
+			t.Errorf("got code %s releasing as bob, want %s", got, codes.PermissionDenied)
+		}
+
+		events, err := m.History(context.Background(), lease.HistoryQuery{Name: "alice/h"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("got %d events, want 1", len(events))
+		}
+		if events[0].Holder != "alice" {
+			t.Errorf("got holder %q, want alice", events[0].Holder)
+		}
+	})
+}
+
+func TestWatchAuth(t *testing.T) {
+	var (
+		rules = []acl.Rule{{Identity: "alice", Prefix: "alice/", Ops: acl.All}}
+		auth  = WithAuthenticator(acl.Tokens{"alicetoken": "alice"})
+		ctx   = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer alicetoken")
+	)
+
+	// wrapped hides the type of the acl.Provider but not its rules.
+	type wrapped struct {
+		lease.Provider
+		acl.Authorizer
+	}
+	a := acl.New(mem.New(), rules...)
+
+	cases := []struct {
+		name  string
+		p     lease.Provider
+		lease string
+	}{{
+		name:  "no authorizer",
+		p:     mem.New(),
+		lease: "alice/x",
+	}, {
+		name:  "wrapped",
+		p:     wrapped{Provider: a, Authorizer: a},
+		lease: "bob/x",
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := dial(t, tc.p, auth)
+			stream, err := client.Watch(ctx, &leasepb.WatchRequest{Name: tc.lease})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = stream.Recv()
+			if got := status.Code(err); got != codes.PermissionDenied {
+				t.Errorf("got code %s, want %s", got, codes.PermissionDenied)
+			}
+		})
+	}
+}
+
+// dial starts an in-process server wrapping p
+// and returns a client for it.
+func dial(t *testing.T, p lease.Provider, opts ...Option) leasepb.LeaseClient {
+	lis := bufconn.Listen(1 << 20)
+
+	gs := grpc.NewServer()
+	leasepb.RegisterLeaseServer(gs, New(p, opts...))
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return leasepb.NewLeaseClient(conn)
+}
@@ -0,0 +1,89 @@
+package lease
+
+import (
+	"context"
+	"time"
+)
+
+// Historian is implemented by a [Provider] that can keep an audit trail of lease activity.
+type Historian interface {
+	// History returns the recorded events matching the given query,
+	// oldest first.
+	History(context.Context, HistoryQuery) ([]Event, error)
+}
+
+// HistoryQuery selects events from a [Historian].
+type HistoryQuery struct {
+	Name  string    // if non-empty, only events for the lease with this name
+	Since time.Time // if non-zero, only events at or after this time
+	Until time.Time // if non-zero, only events before this time
+}
+
+// Match tells whether the given event is selected by q.
+func (q HistoryQuery) Match(ev Event) bool {
+	if q.Name != "" && ev.Name != q.Name {
+		return false
+	}
+	if !q.Since.IsZero() && ev.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !ev.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Event is an entry in the audit trail kept by a [Historian].
+type Event struct {
+	Name   string    // name of the lease
+	Type   EventType // what happened
+	Holder string    // holder identity from the context of the call, if any; see [WithHolder]
+	Time   time.Time // when it happened, according to the provider
+	Exp    time.Time // expiration time of the lease after the event; zero for [EventRelease] and [EventBreak]
+	Reason string    // for [EventBreak], the reason given to [Breaker.Break]
+}
+
+// EventType is the type of an [Event].
+type EventType string
+
+const (
+	// EventAcquire records a lease acquired while not held by anyone.
+	EventAcquire EventType = "acquire"
+
+	// EventTakeover records a lease acquired after it had expired without being released by its previous holder.
+	EventTakeover EventType = "takeover"
+
+	// EventRenew records a lease renewal.
+	EventRenew EventType = "renew"
+
+	// EventRelease records a lease release.
+	EventRelease EventType = "release"
+
+	// EventExpire records a provider discarding an expired lease that was never released.
+	EventExpire EventType = "expire"
+
+	// EventBreak records a lease forcibly ended with [Breaker.Break].
+	// Its Holder is that of the caller of Break,
+	// not of the lease.
+	EventBreak EventType = "break"
+
+	// EventTransfer records a lease handed to a new holder with [Transferer.Transfer].
+	// Its Holder is that of the recipient.
+	EventTransfer EventType = "transfer"
+)
+
+type holderKey struct{}
+
+// WithHolder returns a context carrying the given holder identity.
+// A [Historian] records it with the events caused by calls made with that context.
+func WithHolder(ctx context.Context, holder string) context.Context {
+	return context.WithValue(ctx, holderKey{}, holder)
+}
+
+// Holder returns the holder identity in the given context,
+// or the empty string if there is none.
+// See [WithHolder].
+func Holder(ctx context.Context) string {
+	holder, _ := ctx.Value(holderKey{}).(string)
+	return holder
+}
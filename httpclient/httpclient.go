@@ -0,0 +1,326 @@
+// Package httpclient implements [lease.Provider] as a client of the HTTP/JSON lease API
+// served by github.com/bobg/lease/v2/httpserver.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/acl"
+	"github.com/bobg/lease/v2/internal/deadline"
+	"github.com/bobg/lease/v2/internal/httpapi"
+)
+
+// Client is a lease.Provider implemented as a client of the HTTP/JSON lease API.
+//
+// The holder identity in the context of each call (see [lease.WithHolder])
+// is sent to the server,
+// which passes it on to its provider.
+//
+// Expiration times are computed by callers according to the client's clock (see [WithClock])
+// but enforced by the server's provider according to its own,
+// so the two should agree.
+// To avoid depending on that,
+// use [Client.AcquireTTL] and [Client.RenewTTL],
+// which send durations for the server to measure.
+type Client struct {
+	lease.Clock
+
+	baseURL string
+	hc      *http.Client
+	token   string
+}
+
+var (
+	_ lease.Provider    = &Client{}
+	_ lease.Inspector   = &Client{}
+	_ lease.Breaker     = &Client{}
+	_ lease.TTLProvider = &Client{}
+)
+
+// New creates a new Client for the server at the given base URL,
+// e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		Clock:   lease.DefaultClock{},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		hc:      http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Client)
+
+// WithClock is an [Option] that sets the clock used by the client.
+func WithClock(clock lease.Clock) Option {
+	return func(c *Client) {
+		c.Clock = clock
+	}
+}
+
+// WithHTTPClient is an [Option] that sets the HTTP client used to make requests.
+// The default is [http.DefaultClient].
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.hc = hc
+	}
+}
+
+// WithToken is an [Option] that sets a bearer token to send with each request.
+// See [github.com/bobg/lease/v2/httpserver.WithAuthenticator].
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func (c *Client) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var resp httpapi.AcquireResponse
+	err := c.do(ctx, http.MethodPost, leaseURL(name, "acquire"), httpapi.AcquireRequest{
+		Exp:    &exp,
+		Holder: lease.Holder(ctx),
+	}, &resp)
+	if err != nil {
+		return "", time.Time{}, wrap(err, "acquiring lease %s", name)
+	}
+	if resp.Exp.IsZero() {
+		return "", time.Time{}, errors.Wrapf(ErrNoExp, "acquiring lease %s", name)
+	}
+	return resp.Secret, resp.Exp, nil
+}
+
+func (c *Client) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var resp httpapi.RenewResponse
+	err := c.do(ctx, http.MethodPost, leaseURL(name, "renew"), httpapi.RenewRequest{
+		Secret: secret,
+		Exp:    &exp,
+		Holder: lease.Holder(ctx),
+	}, &resp)
+	if err != nil {
+		return time.Time{}, wrap(err, "renewing lease %s", name)
+	}
+	if resp.Exp.IsZero() {
+		return time.Time{}, errors.Wrapf(ErrNoExp, "renewing lease %s", name)
+	}
+	return resp.Exp, nil
+}
+
+// AcquireTTL implements [lease.TTLProvider].
+// The server measures the duration,
+// passing it on to its provider if that is a [lease.TTLProvider] too.
+func (c *Client) AcquireTTL(ctx context.Context, name string, ttl time.Duration) (string, time.Time, error) {
+	ttl, err := deadline.ClampTTL(ctx, c.Clock, ttl)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	var resp httpapi.AcquireResponse
+	err = c.do(ctx, http.MethodPost, leaseURL(name, "acquire"), httpapi.AcquireRequest{
+		TTL:    ttl.String(),
+		Holder: lease.Holder(ctx),
+	}, &resp)
+	if err != nil {
+		return "", time.Time{}, wrap(err, "acquiring lease %s", name)
+	}
+	if resp.Exp.IsZero() {
+		return "", time.Time{}, errors.Wrapf(ErrNoExp, "acquiring lease %s", name)
+	}
+	return resp.Secret, resp.Exp, nil
+}
+
+// RenewTTL implements [lease.TTLProvider].
+// The server measures the duration,
+// passing it on to its provider if that is a [lease.TTLProvider] too.
+func (c *Client) RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error) {
+	ttl, err := deadline.ClampTTL(ctx, c.Clock, ttl)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+
+	var resp httpapi.RenewResponse
+	err = c.do(ctx, http.MethodPost, leaseURL(name, "renew"), httpapi.RenewRequest{
+		Secret: secret,
+		TTL:    ttl.String(),
+		Holder: lease.Holder(ctx),
+	}, &resp)
+	if err != nil {
+		return time.Time{}, wrap(err, "renewing lease %s", name)
+	}
+	if resp.Exp.IsZero() {
+		return time.Time{}, errors.Wrapf(ErrNoExp, "renewing lease %s", name)
+	}
+	return resp.Exp, nil
+}
+
+// ErrNoExp is the error for a response from the server
+// that lacks the effective expiration time of a lease it granted or renewed.
+var ErrNoExp = errors.New("no expiration time in server response")
+
+func (c *Client) Release(ctx context.Context, name, secret string) error {
+	err := c.do(ctx, http.MethodPost, leaseURL(name, "release"), httpapi.ReleaseRequest{
+		Secret: secret,
+		Holder: lease.Holder(ctx),
+	}, nil)
+	return wrap(err, "releasing lease %s", name)
+}
+
+// Break implements [lease.Breaker].
+func (c *Client) Break(ctx context.Context, name, reason string) error {
+	err := c.do(ctx, http.MethodPost, leaseURL(name, "break"), httpapi.BreakRequest{
+		Reason: reason,
+		Holder: lease.Holder(ctx),
+	}, nil)
+	return wrap(err, "breaking lease %s", name)
+}
+
+// Inspect implements [lease.Inspector].
+func (c *Client) Inspect(ctx context.Context, name string) (lease.Info, bool, error) {
+	var resp httpapi.Info
+	err := c.do(ctx, http.MethodGet, leaseURL(name, ""), nil, &resp)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Code == httpapi.CodeNotFound {
+		return lease.Info{}, false, nil
+	}
+	if err != nil {
+		return lease.Info{}, false, wrap(err, "inspecting lease %s", name)
+	}
+	return lease.Info{Name: resp.Name, Exp: resp.Exp}, true, nil
+}
+
+// List implements [lease.Inspector].
+func (c *Client) List(ctx context.Context, prefix string) ([]lease.Info, error) {
+	var resp httpapi.ListResponse
+	if err := c.do(ctx, http.MethodGet, "/v1/leases?prefix="+url.QueryEscape(prefix), nil, &resp); err != nil {
+		return nil, wrap(err, "listing leases")
+	}
+
+	var result []lease.Info
+	for _, info := range resp.Leases {
+		result = append(result, lease.Info{Name: info.Name, Exp: info.Exp})
+	}
+	return result, nil
+}
+
+// Error is an error response from the server
+// other than one denoting [lease.ErrHeld] or [lease.ErrNotHeld],
+// which are returned as themselves.
+// Errors denying permission also match [acl.ErrDenied],
+// those rejecting credentials also match [acl.ErrUnauthenticated],
+// and those for requests the server's provider does not support also match [errors.ErrUnsupported].
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch e.Code {
+	case httpapi.CodeForbidden:
+		return target == acl.ErrDenied
+	case httpapi.CodeUnauthenticated:
+		return target == acl.ErrUnauthenticated
+	case httpapi.CodeUnimplemented:
+		return target == errors.ErrUnsupported
+	}
+	return false
+}
+
+// do sends a request with the given JSON body (if not nil) to the given path,
+// and decodes the JSON response into resp (if not nil).
+func (c *Client) do(ctx context.Context, method, path string, body, resp any) error {
+	var reqBody io.Reader
+	if body != nil {
+		enc, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "encoding request")
+		}
+		reqBody = bytes.NewReader(enc)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	hresp, err := c.hc.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return errors.Wrap(err, "sending request")
+	}
+	defer hresp.Body.Close()
+
+	if hresp.StatusCode >= 300 {
+		var apiErr httpapi.Error
+		if err := json.NewDecoder(hresp.Body).Decode(&apiErr); err != nil {
+			return &Error{StatusCode: hresp.StatusCode, Message: hresp.Status}
+		}
+		switch apiErr.Code {
+		case httpapi.CodeHeld:
+			return lease.ErrHeld
+		case httpapi.CodeNotHeld:
+			return lease.ErrNotHeld
+		}
+		return &Error{StatusCode: hresp.StatusCode, Code: apiErr.Code, Message: apiErr.Message}
+	}
+
+	if resp == nil || hresp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(hresp.Body).Decode(resp), "decoding response")
+}
+
+// leaseURL returns the path for the lease with the given name,
+// followed by the given action if not empty.
+func leaseURL(name, action string) string {
+	path := "/v1/leases/" + url.PathEscape(name)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+// wrap wraps err with a message,
+// except for the errors a [lease.Provider] returns as-is.
+func wrap(err error, format string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, lease.ErrHeld) || errors.Is(err, lease.ErrNotHeld) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return errors.Wrapf(err, format, args...)
+}
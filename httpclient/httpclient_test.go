@@ -0,0 +1,136 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/acl"
+	"github.com/bobg/lease/v2/httpserver"
+	"github.com/bobg/lease/v2/mem"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+// factory produces clients of a server wrapping a new mem.Provider
+// that uses the same clock.
+func factory(t *testing.T) testutil.Factory {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New()
+		p.Clock = clock
+
+		srv := httptest.NewServer(httpserver.New(p))
+		t.Cleanup(srv.Close)
+
+		return New(srv.URL, WithClock(clock), WithHTTPClient(srv.Client())), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	testutil.Provider(context.Background(), t, factory(t))
+}
+
+func TestLeader(t *testing.T) {
+	testutil.Leader(context.Background(), t, factory(t))
+}
+
+func TestInspector(t *testing.T) {
+	// Names containing slashes are escaped in URLs.
+	testutil.Inspector(context.Background(), t, factory(t))
+}
+
+func TestTTLProvider(t *testing.T) {
+	testutil.TTLProvider(context.Background(), t, factory(t))
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+
+	rules := []acl.Rule{
+		{Identity: "alice", Prefix: "alice/", Ops: acl.All},
+		{Identity: "*", Ops: acl.Inspect},
+	}
+	p := acl.New(mem.New(), rules...)
+	srv := httptest.NewServer(httpserver.New(p, httpserver.WithAuthenticator(acl.Tokens{"alicetoken": "alice", "bobtoken": "bob"})))
+	defer srv.Close()
+
+	var (
+		alice = New(srv.URL, WithToken("alicetoken"))
+		bob   = New(srv.URL, WithToken("bobtoken"))
+		anon  = New(srv.URL)
+		bogus = New(srv.URL, WithToken("bogus"))
+		exp   = time.Now().Add(time.Minute)
+	)
+
+	secret, _, err := alice.Acquire(ctx, "alice/x", exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := alice.Acquire(ctx, "bob/x", exp); !errors.Is(err, acl.ErrDenied) {
+		t.Errorf("alice acquiring bob/x: got error %v, want ErrDenied", err)
+	}
+	if err := bob.Release(ctx, "alice/x", secret); !errors.Is(err, acl.ErrDenied) {
+		t.Errorf("bob releasing alice/x: got error %v, want ErrDenied", err)
+	}
+	if _, _, err := bogus.Acquire(ctx, "alice/y", exp); !errors.Is(err, acl.ErrUnauthenticated) {
+		t.Errorf("acquiring with a bad token: got error %v, want ErrUnauthenticated", err)
+	}
+
+	infos, err := bob.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name != "alice/x" {
+		t.Errorf("bob listing leases: got %v, want alice/x only", infos)
+	}
+
+	// Anonymous callers may not even inspect.
+	infos, err = anon.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("anonymous listing of leases: got %v, want none", infos)
+	}
+	if _, _, err := anon.Inspect(ctx, "alice/x"); !errors.Is(err, acl.ErrDenied) {
+		t.Errorf("anonymous inspection of alice/x: got error %v, want ErrDenied", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	testutil.Breaker(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New(mem.WithHistory(20))
+		p.Clock = clock
+
+		srv := httptest.NewServer(httpserver.New(p))
+		t.Cleanup(srv.Close)
+
+		return New(srv.URL, WithClock(clock), WithHTTPClient(srv.Client())), nil
+	})
+}
+
+func TestNoExp(t *testing.T) {
+	// This server leaves the expiration times out of its responses.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"secret": "secret"}`)
+	}))
+	defer srv.Close()
+
+	var (
+		ctx = context.Background()
+		c   = New(srv.URL, WithHTTPClient(srv.Client()))
+		exp = time.Now().Add(time.Minute)
+	)
+
+	if _, _, err := c.Acquire(ctx, "test", exp); !errors.Is(err, ErrNoExp) {
+		t.Errorf("got error %v from Acquire, want ErrNoExp", err)
+	}
+	if _, err := c.Renew(ctx, "test", "secret", exp); !errors.Is(err, ErrNoExp) {
+		t.Errorf("got error %v from Renew, want ErrNoExp", err)
+	}
+}
@@ -0,0 +1,371 @@
+// Package httpserver serves an HTTP/JSON lease API
+// in terms of any [lease.Provider].
+//
+// This lets shell scripts and programs without a gRPC stack share leases
+// (compare github.com/bobg/lease/v2/grpcserver).
+// A Go client is in github.com/bobg/lease/v2/httpclient.
+//
+// The API is:
+//
+//	POST /v1/leases/{name}/acquire  {"exp": ..., "ttl": ..., "holder": ...}  → {"secret": ..., "exp": ...}
+//	POST /v1/leases/{name}/renew    {"secret": ..., "exp": ..., "ttl": ..., "holder": ...}  → {"exp": ...}
+//	POST /v1/leases/{name}/release  {"secret": ..., "holder": ...}
+//	POST /v1/leases/{name}/break    {"reason": ..., "holder": ...}
+//	GET  /v1/leases/{name}                                                   → {"name": ..., "exp": ...}
+//	GET  /v1/leases?prefix=...                                               → {"leases": [...]}
+//
+// Lease names must be path-escaped in URLs,
+// so that for instance the lease "a/b" is at /v1/leases/a%2Fb.
+// Expiration times are in RFC 3339 format.
+// In acquire and renew requests,
+// a duration string such as "30s" may be given as ttl instead of an exp.
+// If the provider is a [lease.TTLProvider],
+// the ttl is passed to it as such,
+// so that the expiration time is computed by the provider's clock.
+// The holder, if any, is passed to the provider via [lease.WithHolder]
+// (but see [WithAuthenticator]).
+// Break requests forcibly end a lease without its secret (see [lease.Breaker]).
+// The exp in an acquire or renew response is the effective expiration time
+// stored by the provider,
+// which may be earlier than requested.
+//
+// Release and break requests succeed with status 204 (No Content).
+// Failures have a JSON body with a code and a message
+// (see github.com/bobg/lease/v2/internal/httpapi).
+// [lease.ErrHeld] and [lease.ErrNotHeld] produce status 409 (Conflict)
+// with code "held" and "not_held" respectively.
+// Inspecting a lease that is not held produces status 404 (Not Found).
+// Request bodies over 1MiB produce status 413 (Content Too Large).
+// Inspect and list requests produce status 501 (Not Implemented)
+// if the provider is not a [lease.Inspector],
+// and break requests likewise if it is not a [lease.Breaker].
+//
+// Callers may be authenticated with bearer tokens
+// (in an "Authorization: Bearer ..." header)
+// and verified TLS client certificates (see [WithAuthenticator]).
+// Combined with a provider from github.com/bobg/lease/v2/acl,
+// this controls who may do what with which leases.
+// Requests with bad credentials produce status 401 (Unauthorized)
+// with code "unauthenticated",
+// and those the provider denies produce status 403 (Forbidden)
+// with code "forbidden".
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/acl"
+	"github.com/bobg/lease/v2/internal/httpapi"
+)
+
+// New creates an [http.Handler] serving the lease API using the given provider.
+func New(p lease.Provider, opts ...Option) http.Handler {
+	s := &server{p: p}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/leases/{name}/acquire", s.acquire)
+	mux.HandleFunc("POST /v1/leases/{name}/renew", s.renew)
+	mux.HandleFunc("POST /v1/leases/{name}/release", s.release)
+	mux.HandleFunc("POST /v1/leases/{name}/break", s.breakLease)
+	mux.HandleFunc("GET /v1/leases/{name}", s.inspect)
+	mux.HandleFunc("GET /v1/leases", s.list)
+
+	if s.auth == nil {
+		return mux
+	}
+	return s.authenticate(mux)
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*server)
+
+// WithAuthenticator is an [Option] that authenticates each request with the given [acl.Authenticator],
+// placing the caller's identity in the request's context
+// (see [acl.WithIdentity])
+// for the provider to check.
+// The caller's identity is also recorded as the holder of the leases it acquires, renews, and so on
+// (see [acl.Holder]);
+// requests naming a different holder fail with status 403.
+func WithAuthenticator(auth acl.Authenticator) Option {
+	return func(s *server) {
+		s.auth = auth
+	}
+}
+
+type server struct {
+	p    lease.Provider
+	auth acl.Authenticator
+}
+
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var creds acl.Credentials
+		if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			creds.Token = token
+		}
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+			creds.Certs = req.TLS.VerifiedChains[0]
+		}
+
+		identity, err := s.auth.Authenticate(req.Context(), creds)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, httpapi.CodeUnauthenticated, err)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(acl.WithIdentity(req.Context(), identity)))
+	})
+}
+
+func (s *server) acquire(w http.ResponseWriter, req *http.Request) {
+	var body httpapi.AcquireRequest
+	if !decode(w, req, &body) {
+		return
+	}
+	e, err := parseExpiry(body.Exp, body.TTL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, httpapi.CodeBadRequest, err)
+		return
+	}
+
+	ctx, ok := withHolder(w, req, body.Holder)
+	if !ok {
+		return
+	}
+	secret, exp, err := s.acquireFor(ctx, req.PathValue("name"), e)
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, httpapi.AcquireResponse{Secret: secret, Exp: exp})
+}
+
+func (s *server) renew(w http.ResponseWriter, req *http.Request) {
+	var body httpapi.RenewRequest
+	if !decode(w, req, &body) {
+		return
+	}
+	e, err := parseExpiry(body.Exp, body.TTL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, httpapi.CodeBadRequest, err)
+		return
+	}
+
+	ctx, ok := withHolder(w, req, body.Holder)
+	if !ok {
+		return
+	}
+	exp, err := s.renewFor(ctx, req.PathValue("name"), body.Secret, e)
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, httpapi.RenewResponse{Exp: exp})
+}
+
+func (s *server) release(w http.ResponseWriter, req *http.Request) {
+	var body httpapi.ReleaseRequest
+	if !decode(w, req, &body) {
+		return
+	}
+
+	ctx, ok := withHolder(w, req, body.Holder)
+	if !ok {
+		return
+	}
+	if err := s.p.Release(ctx, req.PathValue("name"), body.Secret); err != nil {
+		writeProviderError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) breakLease(w http.ResponseWriter, req *http.Request) {
+	b, ok := s.p.(lease.Breaker)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, httpapi.CodeUnimplemented, errors.New("provider cannot break leases"))
+		return
+	}
+
+	var body httpapi.BreakRequest
+	if !decode(w, req, &body) {
+		return
+	}
+
+	ctx, ok := withHolder(w, req, body.Holder)
+	if !ok {
+		return
+	}
+	if err := b.Break(ctx, req.PathValue("name"), body.Reason); err != nil {
+		writeProviderError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) inspect(w http.ResponseWriter, req *http.Request) {
+	insp, ok := s.p.(lease.Inspector)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, httpapi.CodeUnimplemented, errors.New("provider does not support inspection"))
+		return
+	}
+
+	name := req.PathValue("name")
+	info, ok, err := insp.Inspect(req.Context(), name)
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, httpapi.CodeNotFound, errors.Errorf("lease %s not held", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, httpapi.Info{Name: info.Name, Exp: info.Exp})
+}
+
+func (s *server) list(w http.ResponseWriter, req *http.Request) {
+	insp, ok := s.p.(lease.Inspector)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, httpapi.CodeUnimplemented, errors.New("provider does not support inspection"))
+		return
+	}
+
+	infos, err := insp.List(req.Context(), req.URL.Query().Get("prefix"))
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	resp := httpapi.ListResponse{Leases: []httpapi.Info{}} // not null in the JSON
+	for _, info := range infos {
+		resp.Leases = append(resp.Leases, httpapi.Info{Name: info.Name, Exp: info.Exp})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// expiry is the expiration time given in a request,
+// either directly or as a duration from now.
+type expiry struct {
+	exp time.Time
+	ttl time.Duration // if positive, used instead of exp
+}
+
+func parseExpiry(exp *time.Time, ttl string) (expiry, error) {
+	switch {
+	case exp != nil && ttl != "":
+		return expiry{}, errors.New("exp and ttl are mutually exclusive")
+	case exp != nil:
+		return expiry{exp: *exp}, nil
+	case ttl != "":
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return expiry{}, errors.Wrap(err, "parsing ttl")
+		}
+		if d <= 0 {
+			return expiry{}, errors.Errorf("ttl %s is not positive", d)
+		}
+		return expiry{ttl: d}, nil
+	default:
+		return expiry{}, errors.New("one of exp and ttl is required")
+	}
+}
+
+// acquireFor acquires the named lease until the expiration time given by e.
+// A ttl goes to the provider's AcquireTTL method if it is a [lease.TTLProvider].
+func (s *server) acquireFor(ctx context.Context, name string, e expiry) (string, time.Time, error) {
+	if e.ttl > 0 {
+		if tp, ok := s.p.(lease.TTLProvider); ok {
+			secret, exp, err := tp.AcquireTTL(ctx, name, e.ttl)
+			if !errors.Is(err, errors.ErrUnsupported) {
+				return secret, exp, err
+			}
+			// Otherwise fall back to computing the expiration time here.
+		}
+		e.exp = s.p.Now().Add(e.ttl)
+	}
+	return s.p.Acquire(ctx, name, e.exp)
+}
+
+// renewFor renews the named lease until the expiration time given by e.
+// A ttl goes to the provider's RenewTTL method if it is a [lease.TTLProvider].
+func (s *server) renewFor(ctx context.Context, name, secret string, e expiry) (time.Time, error) {
+	if e.ttl > 0 {
+		if tp, ok := s.p.(lease.TTLProvider); ok {
+			exp, err := tp.RenewTTL(ctx, name, secret, e.ttl)
+			if !errors.Is(err, errors.ErrUnsupported) {
+				return exp, err
+			}
+			// Otherwise fall back to computing the expiration time here.
+		}
+		e.exp = s.p.Now().Add(e.ttl)
+	}
+	return s.p.Renew(ctx, name, secret, e.exp)
+}
+
+// withHolder returns the context of req carrying the holder identity to record
+// for a request naming the given holder
+// (see [acl.Holder]).
+// On failure it writes an error response and returns false.
+func withHolder(w http.ResponseWriter, req *http.Request, holder string) (context.Context, bool) {
+	holder, err := acl.Holder(req.Context(), holder)
+	if err != nil {
+		writeProviderError(w, err)
+		return nil, false
+	}
+	return lease.WithHolder(req.Context(), holder), true
+}
+
+// maxBodyBytes is the largest request body the server reads.
+const maxBodyBytes = 1 << 20
+
+// decode decodes the JSON body of req into v.
+// On failure it writes an error response and returns false.
+func decode(w http.ResponseWriter, req *http.Request, v any) bool {
+	body := http.MaxBytesReader(w, req.Body, maxBodyBytes)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		status := http.StatusBadRequest
+		if errors.As(err, new(*http.MaxBytesError)) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, httpapi.CodeBadRequest, errors.Wrap(err, "decoding request body"))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	writeJSON(w, status, httpapi.Error{Code: code, Message: err.Error()})
+}
+
+// writeProviderError writes the response for an error from the provider.
+func writeProviderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, lease.ErrHeld):
+		writeError(w, http.StatusConflict, httpapi.CodeHeld, err)
+	case errors.Is(err, lease.ErrNotHeld):
+		writeError(w, http.StatusConflict, httpapi.CodeNotHeld, err)
+	case errors.Is(err, acl.ErrDenied):
+		writeError(w, http.StatusForbidden, httpapi.CodeForbidden, err)
+	case errors.Is(err, errors.ErrUnsupported):
+		writeError(w, http.StatusNotImplemented, httpapi.CodeUnimplemented, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusServiceUnavailable, httpapi.CodeInternal, err)
+	default:
+		writeError(w, http.StatusInternalServerError, httpapi.CodeInternal, err)
+	}
+}
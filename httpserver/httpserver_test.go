@@ -0,0 +1,235 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/acl"
+	"github.com/bobg/lease/v2/internal/httpapi"
+	"github.com/bobg/lease/v2/mem"
+)
+
+// skewed is a provider whose Now method is an hour off from the clock it uses for TTLs.
+type skewed struct {
+	*mem.Provider
+}
+
+func (s skewed) Now() time.Time { return s.Provider.Now().Add(time.Hour) }
+
+func TestTTL(t *testing.T) {
+	// The expiration times should come from the provider's own clock,
+	// not from its skewed Now method.
+	p := mem.New()
+	srv := httptest.NewServer(New(skewed{Provider: p}))
+	defer srv.Close()
+
+	before := time.Now()
+
+	resp, err := srv.Client().Post(srv.URL+"/v1/leases/a%2Fb/acquire", "application/json", strings.NewReader(`{"ttl": "1m"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	info, ok, err := p.Inspect(context.Background(), "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("lease a/b not held")
+	}
+	if info.Exp.Before(before.Add(time.Minute)) || info.Exp.After(time.Now().Add(time.Minute)) {
+		t.Errorf("got exp %s, want about a minute from %s", info.Exp, before)
+	}
+
+	var acquired httpapi.AcquireResponse
+	if err := json.NewDecoder(resp.Body).Decode(&acquired); err != nil {
+		t.Fatal(err)
+	}
+
+	before = time.Now()
+
+	resp, err = srv.Client().Post(srv.URL+"/v1/leases/a%2Fb/renew", "application/json", strings.NewReader(`{"secret": "`+acquired.Secret+`", "ttl": "2m"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d renewing, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var renewed httpapi.RenewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&renewed); err != nil {
+		t.Fatal(err)
+	}
+	if renewed.Exp.Before(before.Add(2*time.Minute)) || renewed.Exp.After(time.Now().Add(2*time.Minute)) {
+		t.Errorf("got exp %s after renewing, want about two minutes from %s", renewed.Exp, before)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := httptest.NewServer(New(mem.New()))
+	defer srv.Close()
+
+	// The wrapper hides mem.Provider's Inspector methods.
+	uninspectable := httptest.NewServer(New(struct{ lease.Provider }{mem.New()}))
+	defer uninspectable.Close()
+
+	exp := time.Now().Add(time.Minute).Format(time.RFC3339)
+
+	post := func(path, body string) *http.Response {
+		resp, err := srv.Client().Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	cases := []struct {
+		name       string
+		call       func() *http.Response
+		wantStatus int
+		wantCode   string
+	}{{
+		name:       "bad json",
+		call:       func() *http.Response { return post("/v1/leases/test/acquire", `{`) },
+		wantStatus: http.StatusBadRequest,
+		wantCode:   httpapi.CodeBadRequest,
+	}, {
+		name:       "missing exp",
+		call:       func() *http.Response { return post("/v1/leases/test/acquire", `{}`) },
+		wantStatus: http.StatusBadRequest,
+		wantCode:   httpapi.CodeBadRequest,
+	}, {
+		name:       "exp and ttl",
+		call:       func() *http.Response { return post("/v1/leases/test/acquire", `{"exp": "`+exp+`", "ttl": "1m"}`) },
+		wantStatus: http.StatusBadRequest,
+		wantCode:   httpapi.CodeBadRequest,
+	}, {
+		name:       "zero ttl",
+		call:       func() *http.Response { return post("/v1/leases/test/acquire", `{"ttl": "0s"}`) },
+		wantStatus: http.StatusBadRequest,
+		wantCode:   httpapi.CodeBadRequest,
+	}, {
+		name: "too large",
+		call: func() *http.Response {
+			return post("/v1/leases/test/acquire", `{"holder": "`+strings.Repeat("x", 2<<20)+`"}`)
+		},
+		wantStatus: http.StatusRequestEntityTooLarge,
+		wantCode:   httpapi.CodeBadRequest,
+	}, {
+		name:       "bad ttl",
+		call:       func() *http.Response { return post("/v1/leases/test/acquire", `{"ttl": "soon"}`) },
+		wantStatus: http.StatusBadRequest,
+		wantCode:   httpapi.CodeBadRequest,
+	}, {
+		name: "held",
+		call: func() *http.Response {
+			post("/v1/leases/held/acquire", `{"exp": "`+exp+`"}`).Body.Close()
+			return post("/v1/leases/held/acquire", `{"exp": "`+exp+`"}`)
+		},
+		wantStatus: http.StatusConflict,
+		wantCode:   httpapi.CodeHeld,
+	}, {
+		name:       "not held",
+		call:       func() *http.Response { return post("/v1/leases/test/release", `{"secret": "bogus"}`) },
+		wantStatus: http.StatusConflict,
+		wantCode:   httpapi.CodeNotHeld,
+	}, {
+		name: "not found",
+		call: func() *http.Response {
+			resp, err := srv.Client().Get(srv.URL + "/v1/leases/test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		},
+		wantStatus: http.StatusNotFound,
+		wantCode:   httpapi.CodeNotFound,
+	}, {
+		name: "no inspection",
+		call: func() *http.Response {
+			resp, err := uninspectable.Client().Get(uninspectable.URL + "/v1/leases")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp
+		},
+		wantStatus: http.StatusNotImplemented,
+		wantCode:   httpapi.CodeUnimplemented,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := tc.call()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			var apiErr httpapi.Error
+			if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+				t.Fatal(err)
+			}
+			if apiErr.Code != tc.wantCode {
+				t.Errorf("got code %q, want %q", apiErr.Code, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestHolder(t *testing.T) {
+	var (
+		m     = mem.New(mem.WithHistory(100))
+		rules = []acl.Rule{{Identity: "alice", Ops: acl.All}}
+		srv   = httptest.NewServer(New(acl.New(m, rules...), WithAuthenticator(acl.Tokens{"alicetoken": "alice"})))
+	)
+	defer srv.Close()
+
+	post := func(path, body string) *http.Response {
+		req, err := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer alicetoken")
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Alice may not claim to be someone else.
+	resp := post("/v1/leases/test/acquire", `{"ttl": "1m", "holder": "bob"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d acquiring as bob, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	// With no holder in the request, the holder is the caller's identity.
+	resp = post("/v1/leases/test/acquire", `{"ttl": "1m"}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	events, err := m.History(context.Background(), lease.HistoryQuery{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if events[0].Holder != "alice" {
+		t.Errorf("got holder %q, want alice", events[0].Holder)
+	}
+}
@@ -0,0 +1,25 @@
+package lease
+
+import (
+	"context"
+	"time"
+)
+
+// Inspector is implemented by a [Provider] that can report which leases are held.
+type Inspector interface {
+	// Inspect reports on the lease with the given name.
+	// The boolean result is false if the lease is not held
+	// (or has expired).
+	Inspect(ctx context.Context, name string) (Info, bool, error)
+
+	// List reports on the held, unexpired leases whose names begin with the given prefix,
+	// in order by name.
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// Info describes a held lease.
+// See [Inspector].
+type Info struct {
+	Name string    // name of the lease
+	Exp  time.Time // expiration time of the lease
+}
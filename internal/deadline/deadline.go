@@ -0,0 +1,29 @@
+// Package deadline holds helpers for honoring context deadlines in lease providers.
+package deadline
+
+import (
+	"context"
+	"time"
+
+	"github.com/bobg/lease/v2"
+)
+
+// ClampTTL shortens ttl, if needed,
+// so that a lease expiring after it
+// expires no later than the deadline of ctx (if it has one)
+// according to clock
+// (apart from any rounding by the provider).
+// If that deadline has already passed,
+// it returns [context.DeadlineExceeded].
+func ClampTTL(ctx context.Context, clock lease.Clock, ttl time.Duration) (time.Duration, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		d := deadline.Sub(clock.Now())
+		if d <= 0 {
+			return 0, context.DeadlineExceeded
+		}
+		if d < ttl {
+			return d, nil
+		}
+	}
+	return ttl, nil
+}
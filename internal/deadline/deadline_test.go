@@ -0,0 +1,64 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClampTTL(t *testing.T) {
+	var (
+		t0    = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+		clock = fixedClock{t0}
+	)
+
+	cases := []struct {
+		name     string
+		deadline time.Time
+		want     time.Duration
+		wantErr  error
+	}{{
+		name: "no_deadline",
+		want: time.Minute,
+	}, {
+		name:     "later_deadline",
+		deadline: t0.Add(time.Hour),
+		want:     time.Minute,
+	}, {
+		name:     "earlier_deadline",
+		deadline: t0.Add(10 * time.Second),
+		want:     10 * time.Second,
+	}, {
+		name:     "past_deadline",
+		deadline: t0.Add(-time.Second),
+		wantErr:  context.DeadlineExceeded,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if !tc.deadline.IsZero() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, tc.deadline)
+				defer cancel()
+			}
+
+			got, err := ClampTTL(ctx, clock, time.Minute)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// fixedClock is a [lease.Clock] that is always at the same time.
+type fixedClock struct {
+	t time.Time
+}
+
+func (c fixedClock) Now() time.Time                         { return c.t }
+func (c fixedClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
@@ -0,0 +1,77 @@
+// Package gc holds the background garbage collection
+// shared by the lease providers that keep expired leases until they are deleted:
+// github.com/bobg/lease/v2/pg, pgx, mysql, bolt, and sqlite.
+package gc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bobg/lease/v2"
+)
+
+// DefaultInterval is the default for [Config.Interval].
+const DefaultInterval = 5 * time.Minute
+
+// Config holds a provider's garbage-collection settings.
+type Config struct {
+	Interval time.Duration                  // how often to collect in the background; zero or less means never
+	Batch    int                            // if positive, the most expired leases for one statement to delete
+	Hook     func(deleted int64, err error) // if non-nil, called after each background collection
+}
+
+// Collector runs garbage collection in the background.
+// The zero Collector is not running.
+type Collector struct {
+	cancel context.CancelFunc // stops the goroutine
+	wg     sync.WaitGroup
+}
+
+// Start starts a goroutine calling collect every cfg.Interval, as measured by clock,
+// and passing the results to cfg.Hook,
+// until [Collector.Stop] is called.
+// It does nothing if cfg.Interval is not positive.
+//
+// The goroutine's context has the values of ctx,
+// but is canceled only by Stop.
+func (c *Collector) Start(ctx context.Context, clock lease.Clock, cfg Config, collect func(context.Context) (int64, error)) {
+	if cfg.Interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-clock.After(cfg.Interval):
+				n, err := collect(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				if cfg.Hook != nil {
+					cfg.Hook(n, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the goroutine started by [Collector.Start], if any,
+// and waits for it to exit.
+// It is safe to call more than once.
+func (c *Collector) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil // make this call idempotent
+	}
+	c.wg.Wait()
+}
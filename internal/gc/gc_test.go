@@ -0,0 +1,74 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+func TestCollector(t *testing.T) {
+	var (
+		mockClock = signalClock{Mock: clock.NewMock(), after: make(chan struct{}, 10)}
+		calls     = make(chan int64, 10)
+		n         int64
+	)
+
+	cfg := Config{
+		Interval: time.Minute,
+		Hook:     func(deleted int64, _ error) { calls <- deleted },
+	}
+
+	var c Collector
+	c.Start(context.Background(), mockClock, cfg, func(context.Context) (int64, error) {
+		n++
+		return n, nil
+	})
+
+	for want := int64(1); want <= 3; want++ {
+		<-mockClock.after
+		mockClock.Add(time.Minute)
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Errorf("got %d from collection %d", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for collection %d", want)
+		}
+	}
+
+	<-mockClock.after
+	c.Stop()
+	c.Stop() // idempotent
+
+	mockClock.Add(time.Minute)
+	select {
+	case got := <-calls:
+		t.Errorf("got collection %d after Stop", got)
+	default:
+	}
+}
+
+func TestCollectorDisabled(t *testing.T) {
+	var c Collector
+	c.Start(context.Background(), clock.NewMock(), Config{}, func(context.Context) (int64, error) {
+		t.Error("collect called")
+		return 0, nil
+	})
+	c.Stop()
+}
+
+// signalClock is a mock clock that signals each call to After,
+// so a test can wait for the collector to start waiting before advancing it.
+type signalClock struct {
+	*clock.Mock
+	after chan struct{}
+}
+
+func (c signalClock) After(d time.Duration) <-chan time.Time {
+	ch := c.Mock.After(d)
+	c.after <- struct{}{}
+	return ch
+}
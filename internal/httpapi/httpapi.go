@@ -0,0 +1,80 @@
+// Package httpapi holds the JSON request and response bodies of the HTTP lease API
+// shared by github.com/bobg/lease/v2/httpserver and github.com/bobg/lease/v2/httpclient.
+package httpapi
+
+import "time"
+
+// AcquireRequest is the body of a request to acquire a lease.
+// Exactly one of Exp and TTL must be given.
+// TTL is a duration string such as "30s",
+// measured from the time the server receives the request.
+type AcquireRequest struct {
+	Exp    *time.Time `json:"exp,omitempty"`
+	TTL    string     `json:"ttl,omitempty"`
+	Holder string     `json:"holder,omitempty"`
+}
+
+// AcquireResponse is the body of a successful response to an [AcquireRequest].
+// Exp is the effective expiration time stored by the provider.
+type AcquireResponse struct {
+	Secret string    `json:"secret"`
+	Exp    time.Time `json:"exp"`
+}
+
+// RenewRequest is the body of a request to renew a lease.
+// Exactly one of Exp and TTL must be given,
+// as in [AcquireRequest].
+type RenewRequest struct {
+	Secret string     `json:"secret"`
+	Exp    *time.Time `json:"exp,omitempty"`
+	TTL    string     `json:"ttl,omitempty"`
+	Holder string     `json:"holder,omitempty"`
+}
+
+// RenewResponse is the body of a successful response to a [RenewRequest].
+// Exp is as in [AcquireResponse].
+type RenewResponse struct {
+	Exp time.Time `json:"exp"`
+}
+
+// ReleaseRequest is the body of a request to release a lease.
+type ReleaseRequest struct {
+	Secret string `json:"secret"`
+	Holder string `json:"holder,omitempty"`
+}
+
+// BreakRequest is the body of a request to break a lease.
+type BreakRequest struct {
+	Reason string `json:"reason,omitempty"`
+	Holder string `json:"holder,omitempty"`
+}
+
+// Info describes a held lease.
+// It is the body of a successful response to an inspect request.
+type Info struct {
+	Name string    `json:"name"`
+	Exp  time.Time `json:"exp"`
+}
+
+// ListResponse is the body of a successful response to a list request.
+type ListResponse struct {
+	Leases []Info `json:"leases"`
+}
+
+// Error is the body of an error response.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes.
+const (
+	CodeHeld            = "held"            // the lease is held by someone else (see [github.com/bobg/lease/v2.ErrHeld])
+	CodeNotHeld         = "not_held"        // the lease is not held by the caller (see [github.com/bobg/lease/v2.ErrNotHeld])
+	CodeNotFound        = "not_found"       // the lease is not held by anyone (for inspect requests)
+	CodeBadRequest      = "bad_request"     // the request is malformed
+	CodeUnimplemented   = "unimplemented"   // the server's provider does not support the request
+	CodeUnauthenticated = "unauthenticated" // the caller's credentials are bad
+	CodeForbidden       = "forbidden"       // the caller may not make the request
+	CodeInternal        = "internal"        // anything else
+)
@@ -0,0 +1,202 @@
+// Package pgsql holds the PostgresQL schema and queries
+// shared by the lease providers in github.com/bobg/lease/v2/pg and github.com/bobg/lease/v2/pgx,
+// so that the two interoperate on the same tables.
+package pgsql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bobg/lease/v2"
+)
+
+// CreateTable returns the statement that creates a lease table with the given name.
+func CreateTable(table string) string {
+	const qfmt = `CREATE TABLE IF NOT EXISTS %s (
+		name TEXT NOT NULL PRIMARY KEY,
+		secret TEXT NOT NULL,
+		exp_secs BIGINT NOT NULL
+	)`
+	return fmt.Sprintf(qfmt, table)
+}
+
+// CreateHistory returns the statements that create a history table with the given name,
+// and its indexes.
+func CreateHistory(table string) []string {
+	const qfmt = `CREATE TABLE IF NOT EXISTS %s (
+		id BIGSERIAL NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL,
+		event TEXT NOT NULL,
+		holder TEXT NOT NULL,
+		at_secs BIGINT NOT NULL,
+		exp_secs BIGINT,
+		reason TEXT NOT NULL DEFAULT ''
+	)`
+	result := []string{
+		fmt.Sprintf(qfmt, table),
+
+		// For history tables created before the reason column was added.
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT ''`, table),
+	}
+
+	for _, cols := range [][]string{{"name", "at_secs"}, {"at_secs"}} {
+		const qfmt = `CREATE INDEX IF NOT EXISTS %[1]s_%[2]s ON %[1]s (%[3]s)`
+		result = append(result, fmt.Sprintf(qfmt, table, strings.Join(cols, "_"), strings.Join(cols, ", ")))
+	}
+
+	return result
+}
+
+// Format strings for the lease-table queries.
+// Each is formatted with the table name
+// and (where the format calls for it) the expression for the current time from [Now].
+const (
+	// Args: name, secret, exp_secs.
+	AcquireFmt = `
+		INSERT INTO %[1]s (name, secret, exp_secs) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET secret = $2, exp_secs = $3
+				WHERE %[1]s.exp_secs < %[2]s`
+
+	// Args: exp_secs, name, secret, now_secs.
+	RenewFmt = `UPDATE %s SET exp_secs = $1 WHERE name = $2 AND secret = $3 AND exp_secs > $4`
+
+	// Like AcquireFmt, but with the expiration time computed from the current time.
+	// It is rounded up to a whole second so the lease lasts at least ttl_secs.
+	// Args: name, secret, ttl_secs.
+	AcquireTTLFmt = `
+		INSERT INTO %[1]s (name, secret, exp_secs) VALUES ($1, $2, CEIL((%[2]s)::DOUBLE PRECISION + $3::DOUBLE PRECISION)::BIGINT)
+			ON CONFLICT (name) DO UPDATE SET secret = $2, exp_secs = EXCLUDED.exp_secs
+				WHERE %[1]s.exp_secs < %[2]s`
+
+	// Like RenewFmt, but with the expiration time computed from the current time.
+	// It is rounded up to a whole second so the lease lasts at least ttl_secs.
+	// Args: ttl_secs, name, secret.
+	RenewTTLFmt = `
+		UPDATE %[1]s SET exp_secs = CEIL((%[2]s)::DOUBLE PRECISION + $1::DOUBLE PRECISION)::BIGINT
+			WHERE name = $2 AND secret = $3 AND exp_secs > %[2]s`
+
+	// Args: name, secret.
+	ReleaseFmt = `DELETE FROM %s WHERE name = $1 AND secret = $2`
+
+	// No args.
+	GCFmt = `DELETE FROM %s WHERE exp_secs < %s`
+
+	// Args: batch size.
+	GCBatchFmt = `DELETE FROM %[1]s WHERE name IN (SELECT name FROM %[1]s WHERE exp_secs < %[2]s LIMIT $1)`
+
+	// Args: new secret, exp_secs, name, old secret.
+	TransferFmt = `UPDATE %s SET secret = $1, exp_secs = $2 WHERE name = $3 AND secret = $4 AND exp_secs > %s`
+
+	// Args: name.
+	BreakFmt = `DELETE FROM %s WHERE name = $1 AND exp_secs > %s`
+
+	// Args: name.
+	InspectFmt = `SELECT exp_secs FROM %s WHERE name = $1 AND exp_secs > %s`
+
+	// Args: prefix.
+	// Names are ordered bytewise, regardless of the database's collation.
+	ListFmt = `SELECT name, exp_secs FROM %s WHERE starts_with(name, $1) AND exp_secs > %s ORDER BY name COLLATE "C"`
+)
+
+// Query formats qfmt with the given table name and the expression for the current time from [Now],
+// returning the query and its args.
+func Query(clock lease.Clock, table, qfmt string, qargs []any) (string, []any) {
+	now, qargs := Now(clock, qargs)
+	return fmt.Sprintf(qfmt, table, now), qargs
+}
+
+// Now returns the SQL expression for the current time in seconds since the epoch,
+// adding an arg to qargs if needed.
+//
+// When clock is [lease.DefaultClock], it is OK to rely on the server's clock.
+// Otherwise (e.g. in tests with a mock clock) the time comes from clock.
+func Now(clock lease.Clock, qargs []any) (string, []any) {
+	if _, ok := clock.(lease.DefaultClock); ok {
+		return "EXTRACT(EPOCH FROM NOW())", qargs
+	}
+	qargs = append(qargs, clock.Now().Unix())
+	return fmt.Sprintf("$%d", len(qargs)), qargs
+}
+
+// ReturningExp adds a RETURNING clause to q,
+// a data-modifying statement on the lease table or the result of [Logged] wrapping one,
+// so that it yields the new exp_secs of each affected lease.
+// (In the latter case these come from the history table, where they are the same.)
+func ReturningExp(q string) string {
+	return q + " RETURNING exp_secs"
+}
+
+// AcquireEvent is the SQL expression for the event type of a row affected by an upsert into the lease table.
+// The xmax system column is zero in a freshly inserted row.
+const AcquireEvent = `CASE WHEN xmax = 0 THEN 'acquire' ELSE 'takeover' END`
+
+// Logged wraps q, a data-modifying statement on the lease table with no RETURNING clause,
+// in a statement that also records an event in the given history table for each row it affects.
+// The event type and expiration time are given as SQL expressions over the affected rows.
+// The reason is recorded as given
+// (and should be empty except for break events).
+// The affected-row count of the resulting statement is the same as that of q.
+func Logged(clock lease.Clock, history, holder, reason, q string, qargs []any, event, exp string) (string, []any) {
+	const qfmt = `
+		WITH l AS (%[1]s RETURNING name, (%[2]s)::TEXT AS event, (%[3]s)::BIGINT AS exp_secs)
+		INSERT INTO %[4]s (name, event, holder, at_secs, exp_secs, reason)
+			SELECT name, event, $%[5]d::TEXT, (%[6]s)::BIGINT, exp_secs, $%[7]d::TEXT FROM l`
+
+	qargs = append(qargs, holder)
+	holderArg := len(qargs)
+
+	qargs = append(qargs, reason)
+	reasonArg := len(qargs)
+
+	now, qargs := Now(clock, qargs)
+
+	return fmt.Sprintf(qfmt, q, event, exp, history, holderArg, now, reasonArg), qargs
+}
+
+// History returns the query selecting events from the given history table,
+// and its args.
+// The query's result columns are name, event, holder, at_secs, exp_secs (nullable), and reason;
+// see [Event].
+func History(table string, hq lease.HistoryQuery) (string, []any) {
+	var (
+		conds []string
+		qargs []any
+	)
+	if hq.Name != "" {
+		qargs = append(qargs, hq.Name)
+		conds = append(conds, fmt.Sprintf("name = $%d", len(qargs)))
+	}
+	if !hq.Since.IsZero() {
+		qargs = append(qargs, hq.Since.Unix())
+		conds = append(conds, fmt.Sprintf("at_secs >= $%d", len(qargs)))
+	}
+	if !hq.Until.IsZero() {
+		qargs = append(qargs, hq.Until.Unix())
+		conds = append(conds, fmt.Sprintf("at_secs < $%d", len(qargs)))
+	}
+
+	q := fmt.Sprintf(`SELECT name, event, holder, at_secs, exp_secs, reason FROM %s`, table)
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	q += " ORDER BY at_secs, id"
+
+	return q, qargs
+}
+
+// Event constructs a [lease.Event] from a row of the query returned by [History].
+// A nil expSecs means no expiration time.
+func Event(name, evtype, holder string, atSecs int64, expSecs *int64, reason string) lease.Event {
+	ev := lease.Event{
+		Name:   name,
+		Type:   lease.EventType(evtype),
+		Holder: holder,
+		Time:   time.Unix(atSecs, 0),
+		Reason: reason,
+	}
+	if expSecs != nil {
+		ev.Exp = time.Unix(*expSecs, 0)
+	}
+	return ev
+}
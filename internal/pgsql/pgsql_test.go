@@ -0,0 +1,49 @@
+package pgsql
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bobg/lease/v2"
+)
+
+func TestHistory(t *testing.T) {
+	var (
+		since = time.Unix(100, 0)
+		until = time.Unix(200, 0)
+	)
+
+	cases := []struct {
+		hq        lease.HistoryQuery
+		wantQuery string
+		wantQargs []any
+	}{{
+		wantQuery: `SELECT name, event, holder, at_secs, exp_secs, reason FROM h ORDER BY at_secs, id`,
+	}, {
+		hq:        lease.HistoryQuery{Name: "foo"},
+		wantQuery: `SELECT name, event, holder, at_secs, exp_secs, reason FROM h WHERE name = $1 ORDER BY at_secs, id`,
+		wantQargs: []any{"foo"},
+	}, {
+		hq:        lease.HistoryQuery{Since: since, Until: until},
+		wantQuery: `SELECT name, event, holder, at_secs, exp_secs, reason FROM h WHERE at_secs >= $1 AND at_secs < $2 ORDER BY at_secs, id`,
+		wantQargs: []any{int64(100), int64(200)},
+	}, {
+		hq:        lease.HistoryQuery{Name: "foo", Until: until},
+		wantQuery: `SELECT name, event, holder, at_secs, exp_secs, reason FROM h WHERE name = $1 AND at_secs < $2 ORDER BY at_secs, id`,
+		wantQargs: []any{"foo", int64(200)},
+	}}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("case_%02d", i+1), func(t *testing.T) {
+			gotQuery, gotQargs := History("h", tc.hq)
+			if gotQuery != tc.wantQuery {
+				t.Errorf("got query %q, want %q", gotQuery, tc.wantQuery)
+			}
+			if !slices.Equal(gotQargs, tc.wantQargs) {
+				t.Errorf("got args %v; want %v", gotQargs, tc.wantQargs)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Package secrets generates lease secrets
+// for the providers that need to make their own.
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/bobg/errors"
+)
+
+// New returns a new random secret.
+func New() (string, error) {
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", errors.Wrap(err, "generating secret")
+	}
+	return hex.EncodeToString(secretBytes[:]), nil
+}
@@ -0,0 +1,312 @@
+// Package k8s implements [lease.Provider] in terms of Kubernetes coordination.k8s.io/v1 Lease objects.
+package k8s
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/bobg/errors"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Annotations on a Lease object acquired by a [Provider].
+const (
+	// SecretAnnotation holds the secret of the lease's current holder.
+	SecretAnnotation = "lease.bobg.github.com/secret"
+
+	// HolderAnnotation holds the spec.holderIdentity set when the lease was acquired.
+	HolderAnnotation = "lease.bobg.github.com/holder"
+
+	// AcquireTimeAnnotation holds the spec.acquireTime set when the lease was acquired,
+	// in RFC 3339 format.
+	AcquireTimeAnnotation = "lease.bobg.github.com/acquire-time"
+)
+
+// Provider is a lease.Provider implemented in terms of Kubernetes Lease objects,
+// one per lease name,
+// in the namespace of its [coordinationv1client.LeaseInterface].
+//
+// The fields of a Lease object are used the same way as by the leader election in k8s.io/client-go/tools/leaderelection,
+// so the two can contend for the same Lease:
+// spec.holderIdentity names the holder,
+// and the lease expires spec.leaseDurationSeconds after spec.renewTime.
+// The holder identity is taken from the context (see [lease.WithHolder]),
+// or is the secret if the context has none.
+// The secret itself is kept in the [SecretAnnotation] annotation.
+//
+// Other clients, such as client-go's leader election,
+// leave annotations alone when they take over a Lease object.
+// So the holder identity and acquire time are also recorded in annotations
+// (see [HolderAnnotation] and [AcquireTimeAnnotation]),
+// and the caller holds the lease only while the object's spec still matches them.
+//
+// Since spec.leaseDurationSeconds is a whole number of seconds,
+// expiration times are rounded down to one,
+// and Acquire and Renew fail for leases that would last less than a second.
+//
+// Updates use the object's resourceVersion for optimistic concurrency,
+// so concurrent callers cannot overwrite each other's changes.
+type Provider struct {
+	lease.Clock
+
+	leases coordinationv1client.LeaseInterface
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new Kubernetes lease provider
+// storing leases through the given client,
+// e.g. clientset.CoordinationV1().Leases(namespace).
+func New(leases coordinationv1client.LeaseInterface, opts ...Option) *Provider {
+	p := &Provider{
+		Clock:  lease.DefaultClock{},
+		leases: leases,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	secret := hex.EncodeToString(secretBytes[:])
+
+	holder := lease.Holder(ctx)
+	if holder == "" {
+		holder = secret
+	}
+
+	now := p.Now()
+
+	obj, err := p.leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+		}
+		if err := p.setHolder(obj, holder, secret, now, exp); err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+		}
+
+		created, err := p.leases.Create(ctx, obj, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return "", time.Time{}, lease.ErrHeld
+		}
+		if err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "creating lease %s", name)
+		}
+		return secret, expiration(created), nil
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "getting lease %s", name)
+	}
+
+	if p.isLive(obj) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+
+	if obj.Spec.HolderIdentity == nil || *obj.Spec.HolderIdentity != holder {
+		var transitions int32
+		if obj.Spec.LeaseTransitions != nil {
+			transitions = *obj.Spec.LeaseTransitions
+		}
+		transitions++
+		obj.Spec.LeaseTransitions = &transitions
+	}
+	if err := p.setHolder(obj, holder, secret, now, exp); err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	// The update fails with a conflict if anyone has changed the object since we got it.
+	updated, err := p.leases.Update(ctx, obj, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "updating lease %s", name)
+	}
+
+	return secret, expiration(updated), nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var updated *coordinationv1.Lease
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := p.getHeld(ctx, name, secret)
+		if err != nil {
+			return err
+		}
+		if !p.isLive(obj) {
+			return lease.ErrNotHeld
+		}
+
+		now := p.Now()
+		secs, err := durationSecs(now, exp)
+		if err != nil {
+			return err
+		}
+		obj.Spec.RenewTime = &metav1.MicroTime{Time: now}
+		obj.Spec.LeaseDurationSeconds = secs
+
+		updated, err = p.leases.Update(ctx, obj, metav1.UpdateOptions{})
+		return err
+	})
+	if errors.Is(err, lease.ErrNotHeld) {
+		return time.Time{}, err
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return expiration(updated), nil
+}
+
+// Release releases the lease for the given name, using the provided secret.
+// As in k8s.io/client-go/tools/leaderelection,
+// the Lease object is not deleted but left with an empty holder identity.
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := p.getHeld(ctx, name, secret)
+		if err != nil {
+			return err
+		}
+
+		var (
+			now     = p.Now()
+			noone   = ""
+			oneSecs = int32(1)
+		)
+		obj.Spec.HolderIdentity = &noone
+		obj.Spec.RenewTime = &metav1.MicroTime{Time: now}
+		obj.Spec.LeaseDurationSeconds = &oneSecs
+		delete(obj.Annotations, SecretAnnotation)
+		delete(obj.Annotations, HolderAnnotation)
+		delete(obj.Annotations, AcquireTimeAnnotation)
+
+		_, err = p.leases.Update(ctx, obj, metav1.UpdateOptions{})
+		return err
+	})
+	if errors.Is(err, lease.ErrNotHeld) {
+		return err
+	}
+	return errors.Wrapf(err, "releasing lease %s", name)
+}
+
+// getHeld gets the Lease object with the given name,
+// returning [lease.ErrNotHeld] if it does not exist,
+// has a different secret,
+// or has changed hands since the secret was set.
+func (p *Provider) getHeld(ctx context.Context, name, secret string) (*coordinationv1.Lease, error) {
+	obj, err := p.leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, lease.ErrNotHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ownedBy(obj, secret) {
+		return nil, lease.ErrNotHeld
+	}
+	return obj, nil
+}
+
+// ownedBy tells whether the given Lease object was acquired with the given secret
+// and has not since been taken over by another client.
+func ownedBy(obj *coordinationv1.Lease, secret string) bool {
+	if obj.Annotations[SecretAnnotation] != secret {
+		return false
+	}
+	holder, ok := obj.Annotations[HolderAnnotation]
+	if !ok || obj.Spec.HolderIdentity == nil || *obj.Spec.HolderIdentity != holder {
+		return false
+	}
+	acquired, err := time.Parse(time.RFC3339Nano, obj.Annotations[AcquireTimeAnnotation])
+	if err != nil || obj.Spec.AcquireTime == nil || !obj.Spec.AcquireTime.Time.Equal(acquired) {
+		return false
+	}
+	return true
+}
+
+func (p *Provider) setHolder(obj *coordinationv1.Lease, holder, secret string, now, exp time.Time) error {
+	secs, err := durationSecs(now, exp)
+	if err != nil {
+		return err
+	}
+
+	// The API server keeps only microseconds of a MicroTime,
+	// so truncate the acquire time to match what ownedBy will read back.
+	acquired := now.Truncate(time.Microsecond)
+
+	if obj.Annotations == nil {
+		obj.Annotations = make(map[string]string)
+	}
+	obj.Annotations[SecretAnnotation] = secret
+	obj.Annotations[HolderAnnotation] = holder
+	obj.Annotations[AcquireTimeAnnotation] = acquired.Format(time.RFC3339Nano)
+
+	obj.Spec.HolderIdentity = &holder
+	obj.Spec.AcquireTime = &metav1.MicroTime{Time: acquired}
+	obj.Spec.RenewTime = &metav1.MicroTime{Time: now}
+	obj.Spec.LeaseDurationSeconds = secs
+	return nil
+}
+
+// isLive tells whether the given Lease object has a holder and has not expired.
+func (p *Provider) isLive(obj *coordinationv1.Lease) bool {
+	if obj.Spec.HolderIdentity == nil || *obj.Spec.HolderIdentity == "" {
+		return false
+	}
+	return expiration(obj).After(p.Now())
+}
+
+// expiration returns the expiration time of the given Lease object
+// (its renew time plus its duration),
+// or the zero time if it has none.
+func expiration(obj *coordinationv1.Lease) time.Time {
+	spec := obj.Spec
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return time.Time{}
+	}
+	return spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+}
+
+// durationSecs returns the lease duration in whole seconds from now until exp,
+// rounded down so that the lease expires no later than exp.
+// Lease objects cannot express durations under a second,
+// so it is an error if exp is less than one second from now.
+func durationSecs(now, exp time.Time) (*int32, error) {
+	d := exp.Sub(now)
+	if d < time.Second {
+		return nil, errors.Errorf("lease duration %s is less than the one-second minimum", d)
+	}
+	secs := int32(d / time.Second)
+	return &secs, nil
+}
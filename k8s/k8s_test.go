@@ -0,0 +1,250 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(clock lease.Clock) (lease.Provider, error) {
+	return New(newLeases(), WithClock(clock)), nil
+}
+
+func TestProvider(t *testing.T) {
+	testutil.Provider(context.Background(), t, factory)
+}
+
+func TestLeader(t *testing.T) {
+	testutil.Leader(context.Background(), t, factory)
+}
+
+func TestFields(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		leases    = newLeases()
+		mockClock = clock.NewMock()
+		p         = New(leases, WithClock(mockClock))
+		exp       = mockClock.Now().Add(time.Minute)
+	)
+
+	secret, _, err := p.Acquire(lease.WithHolder(ctx, "alice"), "fields", exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := leases.Get(ctx, "fields", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := obj.Annotations[SecretAnnotation]; got != secret {
+		t.Errorf("got secret annotation %q, want %q", got, secret)
+	}
+	if obj.Spec.HolderIdentity == nil || *obj.Spec.HolderIdentity != "alice" {
+		t.Errorf("got holder identity %v, want alice", obj.Spec.HolderIdentity)
+	}
+	if obj.Spec.LeaseDurationSeconds == nil || *obj.Spec.LeaseDurationSeconds != 60 {
+		t.Errorf("got lease duration %v, want 60", obj.Spec.LeaseDurationSeconds)
+	}
+
+	if err := p.Release(ctx, "fields", secret); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err = leases.Get(ctx, "fields", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Spec.HolderIdentity == nil || *obj.Spec.HolderIdentity != "" {
+		t.Errorf("got holder identity %v after release, want empty", obj.Spec.HolderIdentity)
+	}
+
+	if _, _, err := p.Acquire(lease.WithHolder(ctx, "bob"), "fields", exp); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err = leases.Get(ctx, "fields", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Spec.LeaseTransitions == nil || *obj.Spec.LeaseTransitions != 1 {
+		t.Errorf("got lease transitions %v, want 1", obj.Spec.LeaseTransitions)
+	}
+}
+
+// TestLeaderElection checks that a Lease object taken over by client-go's leader election
+// is no longer held by the provider's caller.
+func TestLeaderElection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		cs     = newClientset()
+		leases = cs.CoordinationV1().Leases("default")
+		p      = New(leases)
+	)
+
+	secret, _, err := p.Acquire(lease.WithHolder(ctx, "ours"), "election", time.Now().Add(1500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		started = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: "election", Namespace: "default"},
+			Client:     cs.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: "theirs"},
+		},
+		LeaseDuration: 5 * time.Second,
+		RenewDeadline: 3 * time.Second,
+		RetryPeriod:   200 * time.Millisecond,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) { close(started) },
+			OnStoppedLeading: func() { close(stopped) },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go elector.Run(ctx)
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for leader election")
+	}
+
+	// The elector's lease is live and our annotations are still on the object,
+	// but the lease is no longer ours.
+	if _, err := p.Renew(ctx, "election", secret, time.Now().Add(time.Minute)); !errors.Is(err, lease.ErrNotHeld) {
+		t.Errorf("got error %v from Renew, want ErrNotHeld", err)
+	}
+	if err := p.Release(ctx, "election", secret); !errors.Is(err, lease.ErrNotHeld) {
+		t.Errorf("got error %v from Release, want ErrNotHeld", err)
+	}
+
+	obj, err := leases.Get(ctx, "election", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Spec.HolderIdentity == nil || *obj.Spec.HolderIdentity != "theirs" {
+		t.Errorf("got holder identity %v, want theirs", obj.Spec.HolderIdentity)
+	}
+	if !elector.IsLeader() {
+		t.Error("elector lost the lease")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for elector to stop")
+	}
+}
+
+// newLeases returns a fake Lease client in the default namespace of a clientset from [newClientset].
+func newLeases() coordinationv1client.LeaseInterface {
+	return newClientset().CoordinationV1().Leases("default")
+}
+
+// newClientset returns a fake clientset
+// that, unlike the plain one,
+// enforces optimistic concurrency on Lease objects with resourceVersion the way a real API server does.
+func newClientset() kubernetes.Interface {
+	var (
+		cs   = fake.NewClientset()
+		mu   sync.Mutex
+		next int
+	)
+
+	nextRV := func() string {
+		next++
+		return strconv.Itoa(next)
+	}
+
+	cs.PrependReactor("create", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		obj := action.(k8stesting.CreateAction).GetObject().(*coordinationv1.Lease)
+		obj.ResourceVersion = nextRV()
+		return false, nil, nil
+	})
+
+	cs.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		obj := action.(k8stesting.UpdateAction).GetObject().(*coordinationv1.Lease)
+
+		cur, err := cs.Tracker().Get(action.GetResource(), action.GetNamespace(), obj.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		if cur.(*coordinationv1.Lease).ResourceVersion != obj.ResourceVersion {
+			return true, nil, apierrors.NewConflict(action.GetResource().GroupResource(), obj.Name, nil)
+		}
+
+		obj.ResourceVersion = nextRV()
+		return false, nil, nil
+	})
+
+	return cs
+}
+
+func TestRounding(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+		p         = New(newLeases(), WithClock(mockClock))
+	)
+	mockClock.Set(t0)
+
+	if _, _, err := p.Acquire(ctx, "rounding", t0.Add(500*time.Millisecond)); err == nil {
+		t.Error("acquired a lease lasting under a second")
+	}
+
+	secret, exp, err := p.Acquire(ctx, "rounding", t0.Add(2700*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := t0.Add(2 * time.Second); !exp.Equal(want) {
+		t.Errorf("got expiration time %s from Acquire, want %s", exp, want)
+	}
+
+	mockClock.Add(time.Second) // t0+1s
+
+	if _, err := p.Renew(ctx, "rounding", secret, t0.Add(1900*time.Millisecond)); err == nil {
+		t.Error("renewed a lease for under a second")
+	}
+
+	exp, err = p.Renew(ctx, "rounding", secret, t0.Add(4900*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := t0.Add(4 * time.Second); !exp.Equal(want) {
+		t.Errorf("got expiration time %s from Renew, want %s", exp, want)
+	}
+}
@@ -2,6 +2,7 @@ package lease
 
 import (
 	"context"
+	"math/rand/v2"
 	"time"
 
 	"github.com/bobg/errors"
@@ -15,7 +16,37 @@ type Leader struct {
 	Dur    time.Duration // how long the lease should be valid for
 	Retry  time.Duration // how often to retry acquiring the lease
 	Jitter time.Duration // plus or minus this much jitter on the retry delay
-	Renew  time.Duration // how often to renew the lease after acquiring it; should be less than Dur
+	Renew  time.Duration // how often to renew the lease after acquiring it; must be less than Dur; zero means adaptive (see [Leader.Run])
+	Tries  int           // how many times to try acquiring the lease before giving up; zero means no limit
+}
+
+// Adaptive renewal timing.
+// See [Leader.Run].
+const (
+	renewFraction = 0.5 // renew after this fraction of the time remaining before the lease expires
+	renewJitter   = 0.1 // plus or minus up to this fraction
+	renewGiveUp   = 20  // stop retrying failed renewals when less than Dur/renewGiveUp remains
+	renewMin      = 20  // wait at least Dur/renewMin between successful renewals
+)
+
+// Validate tells whether l is a usable configuration for [Leader.Run],
+// returning a descriptive error if it is not.
+func (l Leader) Validate() error {
+	switch {
+	case l.Name == "":
+		return errors.New("leader: Name is required")
+	case l.Dur <= 0:
+		return errors.Errorf("leader: Dur (%s) must be positive", l.Dur)
+	case l.Renew < 0:
+		return errors.Errorf("leader: Renew (%s) must not be negative", l.Renew)
+	case l.Renew >= l.Dur:
+		return errors.Errorf("leader: Renew (%s) must be less than Dur (%s)", l.Renew, l.Dur)
+	case l.Retry < 0:
+		return errors.Errorf("leader: Retry (%s) must not be negative", l.Retry)
+	case l.Jitter < 0:
+		return errors.Errorf("leader: Jitter (%s) must not be negative", l.Jitter)
+	}
+	return nil
 }
 
 // Run runs a function after winning a leader election.
@@ -23,13 +54,49 @@ type Leader struct {
 // The election happens by trying to acquire a lease from the given [Provider]
 // using the Name field of l.
 // If the lease is already held by another caller,
-// Run will retry indefinitely at l.Retry intervals (plus or minus up to l.Jitter),
-// until the context is canceled or the lease is acquired.
+// Run will retry at l.Retry intervals (plus or minus up to l.Jitter),
+// until the context is canceled or the lease is acquired,
+// or until it has tried l.Tries times (if that is positive),
+// in which case the error it returns wraps [ErrHeld].
+//
+// Once the lease is acquired, Run will renew it periodically.
+// The lease is valid for l.Dur after each acquisition or renewal,
+// but the provider may grant less (e.g. because of the deadline of ctx),
+// so renewals are scheduled relative to the effective expiration time.
+// By default, each renewal comes after about half the lease's remaining lifetime
+// (plus or minus some jitter, so that many leaders do not renew in lockstep).
+// If l.Renew is positive,
+// each renewal instead leaves a margin of l.Dur - l.Renew before expiration,
+// so that with the full l.Dur granted,
+// renewals happen every l.Renew;
+// but if the lease is too short for that margin,
+// Run falls back to the default.
+// Either way, successful renewals are at least l.Dur/20 apart,
+// so a lease that the provider keeps granting for much less than that
+// (e.g. as the deadline of ctx approaches)
+// is not renewed in a tight loop.
 //
-// Once the lease is acquired, Run will renew it periodically at l.Renew intervals.
+// If a renewal fails,
+// Run retries after half the time remaining before the lease expires,
+// and so more and more often as expiration approaches,
+// until it succeeds,
+// or the provider reports [ErrNotHeld],
+// or less than l.Dur/20 remains.
+//
+// If p is a [TTLProvider],
+// the provider computes the expiration time with its own clock,
+// which may not agree with p.Now.
+// Run does not compare the two:
+// it takes the lease to last l.Dur (or until the deadline of ctx, if sooner)
+// from just before the call to the provider,
+// and schedules renewals by the time elapsed on p.Now since then.
+// Otherwise expiration times are computed from p.Now.
 //
 // The provided function f is run with a context that is canceled if the lease cannot be renewed.
-// If this happens, [context.Cause] will return a [RenewError] wrapping the error from [Provider.Renew].
+// If this happens, [context.Cause] will return a [RenewError] wrapping the last error from [Provider.Renew].
+//
+// Run returns the error from [Leader.Validate] without trying to acquire the lease
+// if l is not a usable configuration.
 //
 // The boolean result from Run indicates whether f was ever called.
 // If f was called and returned an error,
@@ -37,19 +104,31 @@ type Leader struct {
 // (That that may be a [RenewError] wrapping yet another error,
 // if f encountered it and chose to return it.)
 func (l Leader) Run(ctx context.Context, p Provider, f func(context.Context) error) (bool, error) {
+	if err := l.Validate(); err != nil {
+		return false, err
+	}
+
+	maxTries := l.Tries
+	if maxTries <= 0 {
+		maxTries = -1 // retry indefinitely
+	}
+
 	tr := retry.Tryer{
-		Max:         -1,       // retry indefinitely
+		Max:         maxTries,
 		Delay:       l.Retry,  // this often
 		Jitter:      l.Jitter, // plus or minus (up to) this much
 		IsRetryable: func(e error) bool { return errors.Is(e, ErrHeld) },
 		After:       p.After,
 	}
 
-	var secret string
+	var (
+		secret string
+		exp    time.Time
+	)
 
 	err := tr.Try(ctx, func(int) error {
 		var err error
-		secret, err = p.Acquire(ctx, l.Name, p.Now().Add(l.Dur))
+		secret, exp, err = l.acquire(ctx, p)
 		return err
 	})
 	if err != nil {
@@ -64,17 +143,36 @@ func (l Leader) Run(ctx context.Context, p Provider, f func(context.Context) err
 	defer cancel(nil)
 
 	// Renew the lease periodically.
+	// Each timer is measured back from the lease's effective expiration time
+	// (as measured by p.Now; see l.acquire),
+	// so that a slow call to the provider does not eat into the time left for renewing,
+	// and a lease granted for less than l.Dur is renewed in time.
+	renew := p.After(l.untilRenew(p, exp))
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
 
-			case <-p.After(l.Renew):
-				if err := p.Renew(ctx, l.Name, secret, p.Now().Add(l.Dur)); err != nil {
+			case <-renew:
+				newExp, err := l.renew(ctx, p, secret)
+				if err == nil {
+					exp = newExp
+					renew = p.After(l.untilRenew(p, exp))
+					continue
+				}
+				if ctx.Err() != nil {
+					return
+				}
+
+				// Retry unless the lease is definitely lost
+				// or too close to expiring.
+				remaining := exp.Sub(p.Now())
+				if errors.Is(err, ErrNotHeld) || remaining < l.Dur/renewGiveUp {
 					cancel(RenewError{Err: err})
 					return
 				}
+				renew = p.After(remaining / 2)
 			}
 		}
 	}()
@@ -86,6 +184,61 @@ func (l Leader) Run(ctx context.Context, p Provider, f func(context.Context) err
 	return true, err
 }
 
+// acquire acquires the lease for l.Dur from now,
+// returning its secret and effective expiration time as measured by p.Now.
+func (l Leader) acquire(ctx context.Context, p Provider) (string, time.Time, error) {
+	if tp, ok := p.(TTLProvider); ok {
+		start := p.Now()
+		secret, _, err := tp.AcquireTTL(ctx, l.Name, l.Dur)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return secret, l.localExp(ctx, start), err
+		}
+		// Otherwise fall back to computing the expiration time here.
+	}
+	return p.Acquire(ctx, l.Name, p.Now().Add(l.Dur))
+}
+
+// renew renews the lease for l.Dur from now,
+// returning its effective expiration time as measured by p.Now.
+func (l Leader) renew(ctx context.Context, p Provider, secret string) (time.Time, error) {
+	if tp, ok := p.(TTLProvider); ok {
+		start := p.Now()
+		_, err := tp.RenewTTL(ctx, l.Name, secret, l.Dur)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return l.localExp(ctx, start), err
+		}
+		// Otherwise fall back to computing the expiration time here.
+	}
+	return p.Renew(ctx, l.Name, secret, p.Now().Add(l.Dur))
+}
+
+// localExp tells when, as measured by p.Now,
+// a lease granted by a [TTLProvider] for l.Dur expires,
+// given the time start just before the call to the provider.
+// The expiration time reported by the provider
+// is measured by its own clock and cannot be used for this.
+func (l Leader) localExp(ctx context.Context, start time.Time) time.Time {
+	exp := start.Add(l.Dur)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		return deadline
+	}
+	return exp
+}
+
+// untilRenew tells how long to wait before renewing a lease that expires at exp
+// (as measured by p.Now).
+// See [Leader.Run].
+func (l Leader) untilRenew(p Provider, exp time.Time) time.Duration {
+	remaining := exp.Sub(p.Now())
+	if l.Renew > 0 {
+		if d := remaining - (l.Dur - l.Renew); d > 0 {
+			return max(d, l.Dur/renewMin)
+		}
+	}
+	frac := renewFraction + renewJitter*(2*rand.Float64()-1)
+	return max(time.Duration(frac*float64(remaining)), l.Dur/renewMin)
+}
+
 // RenewError is a wrapper for the error from [Provider.Renew]
 // when the lease in [Leader.Run] cannot be renewed.
 type RenewError struct {
@@ -2,11 +2,16 @@ package lease_test
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/bobg/lease"
-	"github.com/bobg/lease/mem"
-	"github.com/bobg/lease/testutil"
+	"github.com/benbjohnson/clock"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/mem"
+	"github.com/bobg/lease/v2/testutil"
 )
 
 func factory(clock lease.Clock) (lease.Provider, error) {
@@ -18,3 +23,387 @@ func factory(clock lease.Clock) (lease.Provider, error) {
 func TestLeader(t *testing.T) {
 	testutil.Leader(context.Background(), t, factory)
 }
+
+func TestLeaderTries(t *testing.T) {
+	ctx := context.Background()
+
+	p := mem.New()
+	if _, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	l := lease.Leader{Name: "test", Dur: time.Minute, Retry: time.Millisecond, Renew: 30 * time.Second, Tries: 2}
+	called, err := l.Run(ctx, p, func(context.Context) error { return nil })
+	if called {
+		t.Error("callback called")
+	}
+	if !errors.Is(err, lease.ErrHeld) {
+		t.Errorf("got error %v, want ErrHeld", err)
+	}
+}
+
+// skewed is a provider whose clock, as seen by its callers,
+// is off from the one it uses for expiration times by skew.
+type skewed struct {
+	*mem.Provider
+	skew time.Duration
+}
+
+func (s skewed) Now() time.Time { return s.Provider.Now().Add(s.skew) }
+
+func TestLeaderTTL(t *testing.T) {
+	cases := []struct {
+		name string
+		skew time.Duration
+	}{{
+		name: "slow",
+		skew: -time.Hour,
+	}, {
+		name: "fast",
+		skew: time.Hour,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			clk := newStepClock()
+			p := mem.New(mem.WithHistory(100))
+			p.Clock = clk
+
+			// The expiration times reported by the provider are an hour off from the caller's clock,
+			// so scheduling renewals by them would renew much too late or much too often.
+			l := lease.Leader{Name: "test", Dur: time.Minute}
+			done, result := runLeader(ctx, l, skewed{Provider: p, skew: tc.skew})
+
+			const steps = 10
+			for range steps {
+				if d := clk.step(t); d < 24*time.Second || d > 36*time.Second {
+					t.Fatalf("renewal scheduled after %s, want about 30s", d)
+				}
+			}
+			clk.wait(t) // for the last renewal to finish
+
+			if _, ok, err := p.Inspect(ctx, "test"); err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				t.Fatal("lease not held")
+			}
+
+			events, err := p.History(ctx, lease.HistoryQuery{Name: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var renewals int
+			for _, ev := range events {
+				if ev.Type == lease.EventRenew {
+					renewals++
+				}
+			}
+			if renewals != steps {
+				t.Errorf("got %d renewals, want %d", renewals, steps)
+			}
+
+			close(done)
+			if err := (<-result).err; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// capped is a provider that grants leases for no longer than max.
+type capped struct {
+	lease.Provider
+	max time.Duration
+}
+
+func (c capped) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	return c.Provider.Acquire(ctx, name, c.limit(exp))
+}
+
+func (c capped) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	return c.Provider.Renew(ctx, name, secret, c.limit(exp))
+}
+
+func (c capped) limit(exp time.Time) time.Time {
+	if limit := c.Now().Add(c.max); limit.Before(exp) {
+		return limit
+	}
+	return exp
+}
+
+func TestLeaderShortLease(t *testing.T) {
+	ctx := context.Background()
+
+	clk := newStepClock()
+	p := mem.New()
+	p.Clock = clk
+
+	// The provider grants much less than Dur,
+	// so renewing every l.Renew would lose the lease.
+	l := lease.Leader{Name: "test", Dur: 10 * time.Second, Retry: time.Second, Renew: 5 * time.Second}
+	done, result := runLeader(ctx, l, capped{Provider: p, max: 2 * time.Second})
+
+	for range 5 {
+		if d := clk.step(t); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("renewal scheduled after %s, want about 1s", d)
+		}
+	}
+	clk.wait(t)
+
+	if _, ok, err := p.Inspect(ctx, "test"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Error("lease not held")
+	}
+
+	close(done)
+	if err := (<-result).err; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeaderValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		leader lease.Leader
+		ok     bool
+	}{{
+		name:   "adaptive",
+		leader: lease.Leader{Name: "test", Dur: time.Minute},
+		ok:     true,
+	}, {
+		name:   "explicit",
+		leader: lease.Leader{Name: "test", Dur: time.Minute, Renew: 30 * time.Second},
+		ok:     true,
+	}, {
+		name:   "no_name",
+		leader: lease.Leader{Dur: time.Minute},
+	}, {
+		name:   "no_dur",
+		leader: lease.Leader{Name: "test"},
+	}, {
+		name:   "renew_too_long",
+		leader: lease.Leader{Name: "test", Dur: time.Minute, Renew: time.Minute},
+	}, {
+		name:   "negative_retry",
+		leader: lease.Leader{Name: "test", Dur: time.Minute, Retry: -time.Second},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.leader.Validate()
+			if tc.ok && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			if !tc.ok {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				p := mem.New()
+				called, runErr := tc.leader.Run(context.Background(), p, func(context.Context) error { return nil })
+				if called {
+					t.Error("callback called")
+				}
+				if runErr == nil || runErr.Error() != err.Error() {
+					t.Errorf("got error %v from Run, want %v", runErr, err)
+				}
+			}
+		})
+	}
+}
+
+// failing is a provider whose Renew fails with err the next n times.
+type failing struct {
+	lease.Provider
+	n   atomic.Int32
+	err error
+}
+
+func (f *failing) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if f.n.Add(-1) >= 0 {
+		return time.Time{}, f.err
+	}
+	return f.Provider.Renew(ctx, name, secret, exp)
+}
+
+func TestLeaderRenewRetry(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		lost bool
+	}{{
+		name: "transient",
+		err:  errors.New("transient"),
+	}, {
+		name: "not_held",
+		err:  lease.ErrNotHeld,
+		lost: true,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := newStepClock()
+			p := mem.New()
+			p.Clock = clk
+
+			f := &failing{Provider: p, err: tc.err}
+			f.n.Store(2)
+
+			l := lease.Leader{Name: "test", Dur: time.Minute}
+			done, result := runLeader(context.Background(), l, f)
+
+			clk.step(t) // first renewal, which fails
+
+			if !tc.lost {
+				// Each retry comes after half the time remaining.
+				if d := clk.step(t); d < 12*time.Second || d > 18*time.Second {
+					t.Errorf("first retry scheduled after %s, want about 15s", d)
+				}
+				if d := clk.step(t); d < 6*time.Second || d > 9*time.Second {
+					t.Errorf("second retry scheduled after %s, want about 7.5s", d)
+				}
+				clk.wait(t) // for the successful renewal to finish
+
+				if _, ok, err := p.Inspect(context.Background(), "test"); err != nil {
+					t.Fatal(err)
+				} else if !ok {
+					t.Error("lease not held")
+				}
+				close(done)
+			}
+
+			res := <-result
+			if !res.called {
+				t.Error("callback not called")
+			}
+			if tc.lost {
+				if !errors.Is(res.err, tc.err) || !errors.As(res.err, new(lease.RenewError)) {
+					t.Errorf("got error %v, want a RenewError wrapping %v", res.err, tc.err)
+				}
+			} else if res.err != nil {
+				t.Errorf("got error %v, want none", res.err)
+			}
+		})
+	}
+}
+
+// counting is a provider that counts calls to Renew.
+type counting struct {
+	lease.Provider
+	n atomic.Int32
+}
+
+func (c *counting) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	c.n.Add(1)
+	return c.Provider.Renew(ctx, name, secret, exp)
+}
+
+func TestLeaderMinRenew(t *testing.T) {
+	clk := newStepClock()
+	p := mem.New()
+	p.Clock = clk
+
+	// The deadline is far enough off in real time not to arrive during the test.
+	ctx, cancel := context.WithDeadline(context.Background(), clk.Now().Add(time.Hour))
+	defer cancel()
+
+	// Each renewal is granted only until the deadline of ctx,
+	// so without a minimum interval
+	// renewals would come faster and faster as the deadline approached.
+	l := lease.Leader{Name: "test", Dur: 2 * time.Hour}
+	done, result := runLeader(ctx, l, p)
+
+	const minRenew = 6 * time.Minute // Dur/20
+	for i := 0; ; i++ {
+		if i == 10 {
+			t.Fatal("renewals never reached the minimum interval")
+		}
+		d := clk.wait(t)
+		if d < minRenew {
+			t.Fatalf("renewal scheduled after %s, want at least %s", d, minRenew)
+		}
+		if d == minRenew {
+			break
+		}
+		clk.Add(d)
+	}
+
+	close(done)
+	if err := (<-result).err; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stepClock is a mock clock that reports on a channel each duration passed to After,
+// so a test can advance it by exactly as long as the code under test is waiting.
+type stepClock struct {
+	*clock.Mock
+	waits chan time.Duration
+}
+
+func newStepClock() *stepClock {
+	c := &stepClock{
+		Mock:  clock.NewMock(),
+		waits: make(chan time.Duration, 100),
+	}
+	c.Set(time.Now())
+	return c
+}
+
+func (c *stepClock) After(d time.Duration) <-chan time.Time {
+	ch := c.Mock.After(d)
+	c.waits <- d
+	return ch
+}
+
+// wait waits for the next call to After and returns its duration.
+func (c *stepClock) wait(t *testing.T) time.Duration {
+	t.Helper()
+
+	select {
+	case d := <-c.waits:
+		return d
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for a call to After")
+		return 0
+	}
+}
+
+// step waits for the next call to After,
+// advances the clock by its duration,
+// and returns the duration.
+func (c *stepClock) step(t *testing.T) time.Duration {
+	t.Helper()
+
+	d := c.wait(t)
+	c.Add(d)
+	return d
+}
+
+type leaderResult struct {
+	called bool
+	err    error
+}
+
+// runLeader runs l with p in a goroutine,
+// with a callback that returns when the done channel is closed
+// or the lease is lost.
+// The result of l.Run is sent on the result channel.
+func runLeader(ctx context.Context, l lease.Leader, p lease.Provider) (done chan struct{}, result chan leaderResult) {
+	done = make(chan struct{})
+	result = make(chan leaderResult, 1)
+	go func() {
+		called, err := l.Run(ctx, p, func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			case <-done:
+				return nil
+			}
+		})
+		result <- leaderResult{called: called, err: err}
+	}()
+	return done, result
+}
@@ -0,0 +1,51 @@
+package leasepb
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bobg/lease/v2"
+)
+
+// FromEvent converts a [lease.Event] to an [Event].
+func FromEvent(ev lease.Event) *Event {
+	return &Event{
+		Name:   ev.Name,
+		Type:   string(ev.Type),
+		Holder: ev.Holder,
+		Time:   Timestamp(ev.Time),
+		Exp:    Timestamp(ev.Exp),
+		Reason: ev.Reason,
+	}
+}
+
+// LeaseEvent converts e to a [lease.Event].
+func (e *Event) LeaseEvent() lease.Event {
+	return lease.Event{
+		Name:   e.GetName(),
+		Type:   lease.EventType(e.GetType()),
+		Holder: e.GetHolder(),
+		Time:   Time(e.GetTime()),
+		Exp:    Time(e.GetExp()),
+		Reason: e.GetReason(),
+	}
+}
+
+// Timestamp converts t to a [timestamppb.Timestamp].
+// The zero time converts to nil.
+func Timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// Time converts ts to a [time.Time].
+// Nil converts to the zero time.
+func Time(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
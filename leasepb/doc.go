@@ -0,0 +1,8 @@
+// Package leasepb holds the protocol buffer and gRPC definitions for the Lease service,
+// which gives network access to a [github.com/bobg/lease/v2.Provider].
+//
+// The server is in github.com/bobg/lease/v2/grpcserver
+// and a Go client is in github.com/bobg/lease/v2/grpcclient.
+package leasepb
+
+//go:generate buf generate
@@ -5,12 +5,14 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bobg/errors"
 
-	"github.com/bobg/lease"
+	"github.com/bobg/lease/v2"
 )
 
 type (
@@ -20,6 +22,10 @@ type (
 
 		mu     sync.Mutex
 		leases map[string]leasePair
+
+		history []lease.Event // ring buffer; see WithHistory
+		next    int           // index in history of the next event to record
+		full    bool          // whether history has wrapped around
 	}
 
 	leasePair struct {
@@ -28,17 +34,47 @@ type (
 	}
 )
 
-var _ lease.Provider = &Provider{}
+var (
+	_ lease.Provider    = &Provider{}
+	_ lease.Historian   = &Provider{}
+	_ lease.Inspector   = &Provider{}
+	_ lease.Breaker     = &Provider{}
+	_ lease.Transferer  = &Provider{}
+	_ lease.TTLProvider = &Provider{}
+)
 
 // New creates a new in-memory lease provider.
-func New() *Provider {
-	return &Provider{
+func New(opts ...Option) *Provider {
+	p := &Provider{
 		Clock:  lease.DefaultClock{},
 		leases: make(map[string]leasePair),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithHistory is an [Option] that makes the provider keep an audit trail
+// of the n most recent lease events.
+// If n is zero or negative, no history is kept.
+// Expired leases discarded by [Provider.GC] are recorded as [lease.EventExpire].
+// See [Provider.History].
+func WithHistory(n int) Option {
+	return func(p *Provider) {
+		if n <= 0 {
+			p.history = nil
+		} else {
+			p.history = make([]lease.Event, n)
+		}
+		p.next, p.full = 0, false
+	}
 }
 
-func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, error) {
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
 	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
 		exp = deadline
 	}
@@ -46,32 +82,39 @@ func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (str
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	now := p.Now()
+
 	pair, ok := p.leases[name]
-	if ok && pair.exp.After(p.Now()) {
-		return "", lease.ErrHeld
+	if ok && pair.exp.After(now) {
+		return "", time.Time{}, lease.ErrHeld
 	}
 
-	var secretBytes [16]byte
-	if _, err := rand.Read(secretBytes[:]); err != nil {
-		return "", errors.Wrap(err, "generating secret")
+	secret, err := newSecret()
+	if err != nil {
+		return "", time.Time{}, err
 	}
-	secret := hex.EncodeToString(secretBytes[:])
 
 	p.leases[name] = leasePair{
 		secret: secret,
 		exp:    exp,
 	}
 
-	return secret, nil
+	evtype := lease.EventAcquire
+	if ok {
+		evtype = lease.EventTakeover
+	}
+	p.record(ctx, name, evtype, now, exp, "")
+
+	return secret, exp, nil
 }
 
-func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) error {
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	pair, isHeld := p.isHeld(name, secret)
 	if !isHeld {
-		return lease.ErrNotHeld
+		return time.Time{}, lease.ErrNotHeld
 	}
 
 	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
@@ -81,10 +124,12 @@ func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time
 	pair.exp = exp
 	p.leases[name] = pair
 
-	return nil
+	p.record(ctx, name, lease.EventRenew, p.Now(), exp, "")
+
+	return exp, nil
 }
 
-func (p *Provider) Release(_ context.Context, name, secret string) error {
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -94,9 +139,179 @@ func (p *Provider) Release(_ context.Context, name, secret string) error {
 
 	delete(p.leases, name)
 
+	p.record(ctx, name, lease.EventRelease, p.Now(), time.Time{}, "")
+
+	return nil
+}
+
+// AcquireTTL implements [lease.TTLProvider].
+func (p *Provider) AcquireTTL(ctx context.Context, name string, ttl time.Duration) (string, time.Time, error) {
+	return p.Acquire(ctx, name, p.Now().Add(ttl))
+}
+
+// RenewTTL implements [lease.TTLProvider].
+func (p *Provider) RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error) {
+	return p.Renew(ctx, name, secret, p.Now().Add(ttl))
+}
+
+// Break implements [lease.Breaker].
+func (p *Provider) Break(ctx context.Context, name, reason string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.Now()
+
+	pair, ok := p.leases[name]
+	if !ok || !pair.exp.After(now) {
+		return lease.ErrNotHeld
+	}
+
+	delete(p.leases, name)
+
+	p.record(ctx, name, lease.EventBreak, now, time.Time{}, reason)
+
 	return nil
 }
 
+// Transfer implements [lease.Transferer].
+func (p *Provider) Transfer(ctx context.Context, name, secret string, exp time.Time) (string, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, isHeld := p.isHeld(name, secret); !isHeld {
+		return "", time.Time{}, lease.ErrNotHeld
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	next, err := newSecret()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	p.leases[name] = leasePair{
+		secret: next,
+		exp:    exp,
+	}
+
+	p.record(ctx, name, lease.EventTransfer, p.Now(), exp, "")
+
+	return next, exp, nil
+}
+
+// GC discards expired leases,
+// returning the number discarded.
+// An expired lease otherwise stays in memory until it is acquired again,
+// so a long-lived provider with many distinct lease names should call GC periodically.
+func (p *Provider) GC(ctx context.Context) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.Now()
+
+	var names []string
+	for name, pair := range p.leases {
+		if !pair.exp.After(now) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		exp := p.leases[name].exp
+		delete(p.leases, name)
+		p.record(ctx, name, lease.EventExpire, now, exp, "")
+	}
+
+	return int64(len(names)), nil
+}
+
+// Inspect implements [lease.Inspector].
+func (p *Provider) Inspect(_ context.Context, name string) (lease.Info, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pair, ok := p.leases[name]
+	if !ok || !pair.exp.After(p.Now()) {
+		return lease.Info{}, false, nil
+	}
+	return lease.Info{Name: name, Exp: pair.exp}, true, nil
+}
+
+// List implements [lease.Inspector].
+func (p *Provider) List(_ context.Context, prefix string) ([]lease.Info, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.Now()
+
+	var result []lease.Info
+	for name, pair := range p.leases {
+		if strings.HasPrefix(name, prefix) && pair.exp.After(now) {
+			result = append(result, lease.Info{Name: name, Exp: pair.exp})
+		}
+	}
+	slices.SortFunc(result, func(a, b lease.Info) int { return strings.Compare(a.Name, b.Name) })
+
+	return result, nil
+}
+
+// History implements [lease.Historian].
+// It reports only events still in the ring buffer;
+// see [WithHistory].
+func (p *Provider) History(_ context.Context, q lease.HistoryQuery) ([]lease.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		result []lease.Event
+		start  int
+		count  = p.next
+	)
+	if p.full {
+		start, count = p.next, len(p.history)
+	}
+	for i := 0; i < count; i++ {
+		ev := p.history[(start+i)%len(p.history)]
+		if q.Match(ev) {
+			result = append(result, ev)
+		}
+	}
+
+	return result, nil
+}
+
+// Precondition: the caller must hold the mutex.
+func (p *Provider) record(ctx context.Context, name string, evtype lease.EventType, now, exp time.Time, reason string) {
+	if len(p.history) == 0 {
+		return
+	}
+
+	p.history[p.next] = lease.Event{
+		Name:   name,
+		Type:   evtype,
+		Holder: lease.Holder(ctx),
+		Time:   now,
+		Exp:    exp,
+		Reason: reason,
+	}
+	p.next++
+	if p.next == len(p.history) {
+		p.next = 0
+		p.full = true
+	}
+}
+
+func newSecret() (string, error) {
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", errors.Wrap(err, "generating secret")
+	}
+	return hex.EncodeToString(secretBytes[:]), nil
+}
+
 // Precondition: the caller must hold the mutex.
 func (p *Provider) isHeld(name, secret string) (leasePair, bool) {
 	pair, ok := p.leases[name]
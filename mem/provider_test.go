@@ -3,9 +3,12 @@ package mem
 import (
 	"context"
 	"testing"
+	"time"
 
-	"github.com/bobg/lease"
-	"github.com/bobg/lease/testutil"
+	"github.com/benbjohnson/clock"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
 )
 
 func factory(clock lease.Clock) (lease.Provider, error) {
@@ -17,3 +20,119 @@ func factory(clock lease.Clock) (lease.Provider, error) {
 func TestProvider(t *testing.T) {
 	testutil.Provider(context.Background(), t, factory)
 }
+
+func TestHistory(t *testing.T) {
+	testutil.History(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := New(WithHistory(10))
+		p.Clock = clock
+		return p, nil
+	})
+}
+
+func TestHistoryRing(t *testing.T) {
+	ctx := context.Background()
+
+	p := New(WithHistory(2))
+	exp := time.Now().Add(time.Minute)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if _, _, err := p.Acquire(ctx, name, exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := p.History(ctx, lease.HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "b" || got[1].Name != "c" {
+		t.Errorf("got %v, want events for b and c", got)
+	}
+}
+
+func TestHistoryNone(t *testing.T) {
+	ctx := context.Background()
+
+	for _, n := range []int{0, -1} {
+		p := New(WithHistory(n))
+		if _, _, err := p.Acquire(ctx, "a", time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := p.History(ctx, lease.HistoryQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Errorf("WithHistory(%d): got %v, want no events", n, got)
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+
+	mockClock := clock.NewMock()
+	p := New(WithHistory(10))
+	p.Clock = mockClock
+
+	t0 := mockClock.Now()
+	if _, _, err := p.Acquire(ctx, "short", t0.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p.Acquire(ctx, "long", t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClock.Add(2 * time.Second)
+
+	n, err := p.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d leases discarded, want 1", n)
+	}
+
+	got, err := p.History(ctx, lease.HistoryQuery{Name: "short"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lease.Event{Name: "short", Type: lease.EventExpire, Time: t0.Add(2 * time.Second), Exp: t0.Add(time.Second)}
+	if len(got) != 2 || got[1] != want {
+		t.Errorf("got %v, want acquire then %v", got, want)
+	}
+
+	if _, ok, err := p.Inspect(ctx, "long"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Error("unexpired lease was discarded")
+	}
+}
+
+func TestInspector(t *testing.T) {
+	testutil.Inspector(context.Background(), t, factory)
+}
+
+func TestBreaker(t *testing.T) {
+	testutil.Breaker(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := New(WithHistory(20))
+		p.Clock = clock
+		return p, nil
+	})
+}
+
+func TestTransferer(t *testing.T) {
+	testutil.Transferer(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := New(WithHistory(20))
+		p.Clock = clock
+		return p, nil
+	})
+}
+
+func TestTTLProvider(t *testing.T) {
+	testutil.TTLProvider(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := New()
+		p.Clock = clock
+		return p, nil
+	})
+}
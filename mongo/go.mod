@@ -0,0 +1,24 @@
+module github.com/bobg/lease/v2/mongo
+
+go 1.22.0
+
+require (
+	github.com/bobg/errors v1.1.0
+	github.com/bobg/lease/v2 v2.0.0
+	go.mongodb.org/mongo-driver/v2 v2.8.0
+)
+
+require (
+	github.com/benbjohnson/clock v1.3.5 // indirect
+	github.com/bobg/retry v0.2.0 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.2.0 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
+
+replace github.com/bobg/lease/v2 => ../
@@ -0,0 +1,153 @@
+// Package mongo implements [lease.Provider] in terms of a MongoDB collection.
+package mongo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/bobg/errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Provider is a lease.Provider implemented in terms of a MongoDB collection.
+//
+// Each lease is a document whose _id is the lease name,
+// holding the lease's secret and expiration time.
+// Acquiring a lease is a single findOneAndUpdate,
+// upserting the document only if it is absent or expired;
+// a concurrent acquirer loses with a duplicate-key error.
+type Provider struct {
+	lease.Clock
+
+	coll *mongo.Collection
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new MongoDB lease provider.
+// Leases are stored in the collection with the given name in db.
+//
+// When the provider uses [lease.DefaultClock],
+// New also ensures the collection has a TTL index on the expiration time,
+// so that the server deletes expired leases.
+// (The TTL monitor uses the server's clock,
+// so the index is not created when the provider uses some other clock.)
+func New(ctx context.Context, db *mongo.Database, collection string, opts ...Option) (*Provider, error) {
+	p := &Provider{
+		Clock: lease.DefaultClock{},
+		coll:  db.Collection(collection),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if _, ok := p.Clock.(lease.DefaultClock); ok {
+		_, err := p.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "exp", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating TTL index on %s", collection)
+		}
+	}
+
+	return p, nil
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	secret := hex.EncodeToString(secretBytes[:])
+
+	var (
+		filter = bson.D{{Key: "_id", Value: name}, p.expCond("$lt")}
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "secret", Value: secret}, {Key: "exp", Value: exp}}}}
+		opts   = options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	)
+
+	// If the lease is held, the filter matches nothing
+	// and the upsert collides with the existing document.
+	var doc record
+	err := p.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, doc.Exp, nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var (
+		filter = bson.D{{Key: "_id", Value: name}, {Key: "secret", Value: secret}, p.expCond("$gt")}
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "exp", Value: exp}}}}
+		opts   = options.FindOneAndUpdate().SetReturnDocument(options.After)
+	)
+
+	var doc record
+	err := p.coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return doc.Exp, nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	res, err := p.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: name}, {Key: "secret", Value: secret}})
+	if err != nil {
+		return errors.Wrapf(err, "releasing lease %s", name)
+	}
+	if res.DeletedCount == 0 {
+		return lease.ErrNotHeld
+	}
+	return nil
+}
+
+// record is the part of a lease document decoded after an update.
+// The stored expiration time has millisecond precision.
+type record struct {
+	Exp time.Time `bson:"exp"`
+}
+
+// expCond returns a filter element comparing a lease's expiration time to the current time
+// with the given comparison operator.
+//
+// When the provider uses [lease.DefaultClock], it is OK to rely on the server's clock ($$NOW).
+// Otherwise (e.g. in tests with a mock clock) the time comes from the provider's clock.
+func (p *Provider) expCond(op string) bson.E {
+	if _, ok := p.Clock.(lease.DefaultClock); ok {
+		return bson.E{Key: "$expr", Value: bson.D{{Key: op, Value: bson.A{"$exp", "$$NOW"}}}}
+	}
+	return bson.E{Key: "exp", Value: bson.D{{Key: op, Value: p.Now()}}}
+}
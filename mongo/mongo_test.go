@@ -0,0 +1,94 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(db *mongo.Database, collection string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(context.Background(), db, collection, WithClock(clock))
+	}
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+
+	withCollection(ctx, t, func(db *mongo.Database, collection string) {
+		testutil.Provider(ctx, t, factory(db, collection))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	ctx := context.Background()
+
+	withCollection(ctx, t, func(db *mongo.Database, collection string) {
+		testutil.Leader(ctx, t, factory(db, collection))
+	})
+}
+
+func TestDefaultClock(t *testing.T) {
+	ctx := context.Background()
+
+	withCollection(ctx, t, func(db *mongo.Database, collection string) {
+		p, err := New(ctx, db, collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute)); !errors.Is(err, lease.ErrHeld) {
+			t.Errorf("got error %v, want ErrHeld", err)
+		}
+		if _, err := p.Renew(ctx, "test", secret, time.Now().Add(2*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Release(ctx, "test", secret); err != nil {
+			t.Fatal(err)
+		}
+
+		// A lease whose expiration time has passed (according to the server) can be taken over.
+		if _, _, err := p.Acquire(ctx, "test2", time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p.Acquire(ctx, "test2", time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// withCollection calls f with the database at MONGODB_URI
+// and the name of a fresh collection.
+func withCollection(ctx context.Context, t *testing.T, f func(*mongo.Database, string)) {
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		t.Skip("MONGODB_URI must be set")
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+
+	var (
+		db         = client.Database("test")
+		collection = fmt.Sprintf("leases_%d", time.Now().UnixNano())
+	)
+	defer db.Collection(collection).Drop(ctx)
+
+	f(db, collection)
+}
@@ -0,0 +1,258 @@
+// Package mysql implements [lease.Provider] in terms of a MySQL or MariaDB database.
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/internal/gc"
+	"github.com/bobg/lease/v2/internal/secrets"
+)
+
+// Provider is a lease.Provider implemented in terms of a MySQL or MariaDB database.
+//
+// It relies on the affected-row counts that the server reports by default.
+// The database handle must therefore not be opened with the clientFoundRows DSN parameter.
+type Provider struct {
+	lease.Clock
+
+	table string // name of the table that stores leases
+	db    *sql.DB
+
+	gcConfig  gc.Config
+	collector gc.Collector // runs GC in the background
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new MySQL lease provider.
+// Leases are stored in a table with the given name.
+// The table is created if it does not already exist.
+func New(ctx context.Context, db *sql.DB, table string, opts ...Option) (*Provider, error) {
+	const qfmt = `CREATE TABLE IF NOT EXISTS %s (
+		name VARCHAR(255) NOT NULL PRIMARY KEY,
+		secret CHAR(32) NOT NULL,
+		exp_secs BIGINT NOT NULL
+	)`
+	q := fmt.Sprintf(qfmt, table)
+
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return nil, errors.Wrapf(err, "creating table %s", table)
+	}
+
+	p := &Provider{
+		Clock:    lease.DefaultClock{},
+		table:    table,
+		db:       db,
+		gcConfig: gc.Config{Interval: DefaultGCInterval},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	// The caller's context governs only the construction of p.
+	// The garbage collector runs until Close is called.
+	p.collector.Start(ctx, p.Clock, p.gcConfig, p.GC)
+
+	return p, nil
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// DefaultGCInterval is how often a [Provider] deletes expired leases
+// unless overridden with [WithGCInterval].
+const DefaultGCInterval = gc.DefaultInterval
+
+// WithGCInterval is an [Option] that sets how often the provider deletes expired leases from its table.
+// A value of zero or less disables the background garbage collector;
+// expired leases can still be deleted on demand with [Provider.GC].
+func WithGCInterval(d time.Duration) Option {
+	return func(p *Provider) {
+		p.gcConfig.Interval = d
+	}
+}
+
+// WithGCBatchSize is an [Option] that limits how many expired leases a single DELETE statement removes.
+// Garbage collection issues as many statements as needed.
+// A value of zero or less (the default) means no limit.
+func WithGCBatchSize(n int) Option {
+	return func(p *Provider) {
+		p.gcConfig.Batch = n
+	}
+}
+
+// WithGCHook is an [Option] that sets a function to call after each run of the background garbage collector
+// with the number of expired leases deleted and the error, if any.
+func WithGCHook(f func(deleted int64, err error)) Option {
+	return func(p *Provider) {
+		p.gcConfig.Hook = f
+	}
+}
+
+// Close stops the background garbage collector (if any) and waits for it to exit.
+// It does _not_ close the underlying database connection.
+func (p *Provider) Close() {
+	p.collector.Stop()
+}
+
+// GC deletes expired leases from the provider's table,
+// returning the number deleted.
+// It is called periodically in the background unless disabled with [WithGCInterval],
+// but may also be called directly.
+func (p *Provider) GC(ctx context.Context) (int64, error) {
+	var total int64
+
+	for {
+		const qfmt = `DELETE FROM %s WHERE exp_secs < %s`
+		q := p.queryWithExpSecs(qfmt)
+		if p.gcConfig.Batch > 0 {
+			q += fmt.Sprintf(" LIMIT %d", p.gcConfig.Batch)
+		}
+
+		res, err := p.db.ExecContext(ctx, q)
+		if err != nil {
+			return total, errors.Wrap(err, "deleting expired leases")
+		}
+		aff, err := res.RowsAffected()
+		if err != nil {
+			return total, errors.Wrap(err, "counting affected rows")
+		}
+		total += aff
+
+		if p.gcConfig.Batch <= 0 || aff < int64(p.gcConfig.Batch) {
+			return total, nil
+		}
+	}
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	secret, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// The assignments in ON DUPLICATE KEY UPDATE happen left to right,
+	// so exp_secs must be assigned last,
+	// after the test of its old value has been used for secret.
+	const qfmt = `
+		INSERT INTO %[1]s (name, secret, exp_secs) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				secret = IF(exp_secs < %[2]s, VALUES(secret), secret),
+				exp_secs = IF(exp_secs < %[2]s, VALUES(exp_secs), exp_secs)`
+
+	q := p.queryWithExpSecs(qfmt)
+
+	// The affected-row count is 1 for an insert, 2 for an update, and 0 if the lease is held.
+	res, err := p.db.ExecContext(ctx, q, name, secret, exp.Unix())
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return "", time.Time{}, lease.ErrHeld
+	}
+
+	return secret, time.Unix(exp.Unix(), 0), nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var (
+		expSecs = exp.Unix()
+		nowSecs = p.Now().Unix()
+	)
+
+	const qfmt = `UPDATE %s SET exp_secs = ? WHERE name = ? AND secret = ? AND exp_secs > ?`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	res, err := p.db.ExecContext(ctx, q, expSecs, name, secret, nowSecs)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "counting affected rows")
+	}
+	if aff > 0 {
+		return time.Unix(expSecs, 0), nil
+	}
+
+	// MySQL does not count a row as affected if the update leaves it unchanged,
+	// as when renewing with the same expiration time.
+	const checkfmt = `SELECT COUNT(*) FROM %s WHERE name = ? AND secret = ? AND exp_secs > ?`
+	q = fmt.Sprintf(checkfmt, p.table)
+
+	var count int
+	if err := p.db.QueryRowContext(ctx, q, name, secret, nowSecs).Scan(&count); err != nil {
+		return time.Time{}, errors.Wrapf(err, "checking lease %s", name)
+	}
+	if count == 0 {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	return time.Unix(expSecs, 0), nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	const qfmt = `DELETE FROM %s WHERE name = ? AND secret = ?`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	res, err := p.db.ExecContext(ctx, q, name, secret)
+	if err != nil {
+		return errors.Wrapf(err, "releasing lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return lease.ErrNotHeld
+	}
+
+	return nil
+}
+
+// queryWithExpSecs formats qfmt with the table name
+// and the SQL expression for the current time in seconds since the epoch.
+//
+// Unlike in PostgresQL, placeholders in MySQL are positional,
+// so a time that does not come from the server is interpolated as a literal
+// rather than passed as an arg.
+// (It is an integer from the provider's own clock, so this is safe.)
+func (p *Provider) queryWithExpSecs(qfmt string) string {
+	var now string
+
+	if _, ok := p.Clock.(lease.DefaultClock); ok {
+		// OK to rely on the server's clock.
+		now = "UNIX_TIMESTAMP()"
+	} else {
+		// Do not rely on the server's clock.
+		now = fmt.Sprintf("%d", p.Now().Unix())
+	}
+
+	return fmt.Sprintf(qfmt, p.table, now)
+}
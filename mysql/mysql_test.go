@@ -0,0 +1,134 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(ctx context.Context, db *sql.DB, table string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(ctx, db, table, WithClock(clock))
+	}
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		testutil.Provider(ctx, t, factory(ctx, db, "leases"))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		testutil.Leader(ctx, t, factory(ctx, db, "leases"))
+	})
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		var (
+			mockClock = clock.NewMock()
+			t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+		)
+		mockClock.Set(t0)
+
+		p, err := New(ctx, db, "gc_leases", WithClock(mockClock), WithGCInterval(0), WithGCBatchSize(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+
+		for i := 0; i < 5; i++ {
+			if _, _, err := p.Acquire(ctx, fmt.Sprintf("gc%d", i), t0.Add(10*time.Second)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mockClock.Add(20 * time.Second)
+
+		n, err := p.GC(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 {
+			t.Errorf("got %d deleted after expiry, want 5", n)
+		}
+	})
+}
+
+func withDB(ctx context.Context, t *testing.T, f func(*sql.DB)) {
+	var (
+		dbhost   = os.Getenv("MYSQL_HOST")
+		dbport   = os.Getenv("MYSQL_PORT")
+		dbname   = os.Getenv("MYSQL_DATABASE")
+		dbuser   = os.Getenv("MYSQL_USER")
+		dbpasswd = os.Getenv("MYSQL_PASSWORD")
+	)
+
+	if dbuser == "" {
+		t.Skip("MYSQL_USER must be set")
+	}
+
+	if dbhost == "" {
+		dbhost = "localhost"
+	}
+	if dbport == "" {
+		dbport = "3306"
+	}
+	if dbname == "" {
+		dbname = dbuser
+	}
+
+	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", dbuser, dbpasswd, dbhost, dbport, dbname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	f(db)
+}
+
+func TestQueryWithExpSecs(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC))
+
+	cases := []struct {
+		clock lease.Clock
+		want  string
+	}{{
+		clock: lease.DefaultClock{},
+		want:  `DELETE FROM table WHERE exp_secs < UNIX_TIMESTAMP()`,
+	}, {
+		clock: mockClock,
+		want:  fmt.Sprintf(`DELETE FROM table WHERE exp_secs < %d`, mockClock.Now().Unix()),
+	}}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("case_%02d", i+1), func(t *testing.T) {
+			p := &Provider{
+				Clock: tc.clock,
+				table: "table",
+			}
+
+			got := p.queryWithExpSecs(`DELETE FROM %s WHERE exp_secs < %s`)
+			if got != tc.want {
+				t.Errorf("got query %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
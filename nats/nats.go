@@ -0,0 +1,299 @@
+// Package nats implements [lease.Provider] in terms of a NATS JetStream key-value bucket.
+package nats
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/bobg/errors"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Provider is a lease.Provider implemented in terms of a NATS JetStream key-value bucket.
+//
+// Each lease is stored under a key equal to its name,
+// which must therefore be a valid key-value key.
+// New keys are created only if absent,
+// and existing keys are changed only if their revision is the one observed,
+// so concurrent callers cannot overwrite each other's changes.
+// Each write carries a per-key TTL covering the lease's lifetime,
+// so that the server deletes the keys of holders that disappear.
+//
+// Expiration is decided according to the provider's clock (see [WithClock]),
+// not the per-key TTLs,
+// which are only a backstop for cleanup.
+//
+// Callers wishing to wait for a lease that is held elsewhere can use [Provider.AcquireWait],
+// which watches the key rather than polling.
+type Provider struct {
+	lease.Clock
+
+	js      jetstream.JetStream
+	kv      jetstream.KeyValue
+	subject string // prefix of the subjects of the bucket's keys
+}
+
+var (
+	_ lease.Provider = &Provider{}
+	_ lease.Waiter   = &Provider{}
+)
+
+// markerTTL is how long the server keeps the markers left by deleted and expired keys.
+const markerTTL = time.Minute
+
+// New creates a new NATS lease provider.
+// Leases are stored in the key-value bucket with the given name.
+// The bucket is created if it does not already exist,
+// and is otherwise updated to allow per-key TTLs.
+// This requires NATS server 2.11 or later.
+func New(ctx context.Context, js jetstream.JetStream, bucket string, opts ...Option) (*Provider, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:         bucket,
+		Description:    "leases",
+		LimitMarkerTTL: markerTTL,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating bucket %s", bucket)
+	}
+
+	p := &Provider{
+		Clock:   lease.DefaultClock{},
+		js:      js,
+		kv:      kv,
+		subject: "$KV." + bucket + ".",
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// record is the JSON-encoded value stored under a lease's key.
+type record struct {
+	Secret string    `json:"secret"`
+	Exp    time.Time `json:"exp"`
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	secret, exp, err := p.acquire(ctx, name, exp)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return secret, exp, nil
+}
+
+// acquire tries to acquire the named lease,
+// returning its secret and expiration time.
+// If the lease is held by someone else,
+// it returns [lease.ErrHeld] together with the holder's expiration time,
+// which is zero if not known.
+func (p *Provider) acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	entry, err := p.get(ctx, name)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if entry != nil {
+		var rec record
+		if err := json.Unmarshal(entry.Value(), &rec); err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "decoding lease %s", name)
+		}
+		if rec.Exp.After(p.Now()) {
+			return "", rec.Exp, lease.ErrHeld
+		}
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	secret := hex.EncodeToString(secretBytes[:])
+
+	value, err := json.Marshal(record{Secret: secret, Exp: exp})
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "encoding lease")
+	}
+
+	if entry == nil {
+		_, err = p.kv.Create(ctx, name, value, jetstream.KeyTTL(p.ttlFor(exp)))
+	} else {
+		// The lease has expired.
+		// Replace it, unless someone else has changed it in the meantime.
+		err = p.update(ctx, name, value, entry.Revision(), exp)
+	}
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, exp, nil
+}
+
+// AcquireWait is like [Provider.Acquire]
+// but if the lease is held by someone else,
+// it waits until the lease is released or expires and tries again,
+// until it succeeds or the context is canceled.
+//
+// Rather than polling,
+// it watches the lease's key for changes
+// and sets a timer for the holder's expiration time.
+func (p *Provider) AcquireWait(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	// Watch first, so no release between an attempt and the wait for the next one can be missed.
+	w, err := p.kv.Watch(ctx, name, jetstream.UpdatesOnly(), jetstream.MetaOnly())
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "watching lease %s", name)
+	}
+	defer w.Stop()
+
+	for {
+		// On ErrHeld, leaseExp is the holder's expiration time.
+		secret, leaseExp, err := p.acquire(ctx, name, exp)
+		if !errors.Is(err, lease.ErrHeld) {
+			return secret, leaseExp, err
+		}
+
+		var timer <-chan time.Time
+		if !leaseExp.IsZero() {
+			timer = p.After(leaseExp.Sub(p.Now()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", time.Time{}, ctx.Err()
+
+		case _, ok := <-w.Updates():
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return "", time.Time{}, err
+				}
+				return "", time.Time{}, errors.Errorf("watcher for lease %s stopped", name)
+			}
+
+		case <-timer:
+		}
+	}
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	entry, err := p.get(ctx, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if entry == nil {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	var rec record
+	if err := json.Unmarshal(entry.Value(), &rec); err != nil {
+		return time.Time{}, errors.Wrapf(err, "decoding lease %s", name)
+	}
+	if rec.Secret != secret || !rec.Exp.After(p.Now()) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	rec.Exp = exp
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "encoding lease")
+	}
+
+	err = p.update(ctx, name, value, entry.Revision(), exp)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return exp, nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	entry, err := p.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return lease.ErrNotHeld
+	}
+
+	var rec record
+	if err := json.Unmarshal(entry.Value(), &rec); err != nil {
+		return errors.Wrapf(err, "decoding lease %s", name)
+	}
+	if rec.Secret != secret {
+		return lease.ErrNotHeld
+	}
+
+	err = p.kv.Purge(ctx, name, jetstream.LastRevision(entry.Revision()), jetstream.PurgeTTL(markerTTL))
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return lease.ErrNotHeld
+	}
+	return errors.Wrapf(err, "releasing lease %s", name)
+}
+
+// get returns the entry for the named lease,
+// or nil if there is none.
+func (p *Provider) get(ctx context.Context, name string) (jetstream.KeyValueEntry, error) {
+	entry, err := p.kv.Get(ctx, name)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return entry, errors.Wrapf(err, "getting lease %s", name)
+}
+
+// update replaces the value of the named lease if its revision is still the given one,
+// with a TTL covering the time until exp.
+//
+// This publishes directly to the key's subject,
+// since [jetstream.KeyValue] can set a TTL only when creating a key.
+// (For this reason the provider does not support JetStream domains or API prefixes.)
+// A revision mismatch produces an error matching [jetstream.ErrKeyExists].
+func (p *Provider) update(ctx context.Context, name string, value []byte, revision uint64, exp time.Time) error {
+	msg := &natsgo.Msg{
+		Subject: p.subject + name,
+		Header:  natsgo.Header{},
+		Data:    value,
+	}
+	_, err := p.js.PublishMsg(ctx, msg,
+		jetstream.WithExpectLastSequencePerSubject(revision),
+		jetstream.WithMsgTTL(p.ttlFor(exp)),
+	)
+	return err
+}
+
+// ttlFor returns the per-key TTL needed to cover the time from now until exp,
+// rounded up to a whole number of seconds.
+func (p *Provider) ttlFor(exp time.Time) time.Duration {
+	d := exp.Sub(p.Now())
+	ttl := d.Truncate(time.Second)
+	if ttl < d {
+		ttl += time.Second
+	}
+	return max(ttl, time.Second)
+}
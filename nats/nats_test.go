@@ -0,0 +1,192 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(js jetstream.JetStream, bucket string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(context.Background(), js, bucket, WithClock(clock))
+	}
+}
+
+func TestProvider(t *testing.T) {
+	withJetStream(t, func(js jetstream.JetStream) {
+		testutil.Provider(context.Background(), t, factory(js, "provider"))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	withJetStream(t, func(js jetstream.JetStream) {
+		testutil.Leader(context.Background(), t, factory(js, "leader"))
+	})
+}
+
+func TestAcquireWait(t *testing.T) {
+	ctx := context.Background()
+
+	withJetStream(t, func(js jetstream.JetStream) {
+		var (
+			mockClock = clock.NewMock()
+			t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+		)
+		mockClock.Set(t0)
+
+		p, err := New(ctx, js, "wait", WithClock(mockClock))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret, _, err := p.Acquire(ctx, "test", t0.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		type result struct {
+			secret string
+			err    error
+		}
+		ch := make(chan result, 1)
+
+		go func() {
+			secret, _, err := p.AcquireWait(ctx, "test", t0.Add(2*time.Hour))
+			ch <- result{secret: secret, err: err}
+		}()
+
+		select {
+		case r := <-ch:
+			t.Fatalf("AcquireWait returned (%q, %v) while the lease was held", r.secret, r.err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		if err := p.Release(ctx, "test", secret); err != nil {
+			t.Fatal(err)
+		}
+
+		// The mock clock has not moved,
+		// so only the watch can wake the waiter.
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if r.secret == secret {
+				t.Error("got the released secret")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("AcquireWait did not return after release")
+		}
+
+		// Now test waking on expiry.
+
+		secret, _, err = p.Acquire(ctx, "test2", t0.Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		go func() {
+			secret, _, err := p.AcquireWait(ctx, "test2", t0.Add(2*time.Hour))
+			ch <- result{secret: secret, err: err}
+		}()
+
+		time.Sleep(100 * time.Millisecond) // let the waiter set its timer
+		mockClock.Add(2 * time.Minute)
+
+		r := <-ch
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if r.secret == secret {
+			t.Error("got the expired secret")
+		}
+	})
+}
+
+func TestKeyTTL(t *testing.T) {
+	ctx := context.Background()
+
+	withJetStream(t, func(js jetstream.JetStream) {
+		p, err := New(ctx, js, "ttl")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		kv, err := js.KeyValue(ctx, "ttl")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The server should delete the abandoned lease's key.
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			_, err := kv.Get(ctx, "test")
+			if errors.Is(err, jetstream.ErrKeyNotFound) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("key not deleted")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		// It can be acquired again.
+		if _, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// withJetStream calls f with a JetStream context for an embedded NATS server.
+func withJetStream(t *testing.T, f func(jetstream.JetStream)) {
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Shutdown()
+
+	if !srv.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := natsgo.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f(js)
+}
@@ -0,0 +1,259 @@
+package pg
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/internal/pgsql"
+)
+
+// WithAdvisoryLocks is an [Option] that puts the provider in advisory-lock mode.
+//
+// In this mode, the provider opens a dedicated connection from its [sql.DB]
+// and, in addition to using the lease table,
+// holds a PostgresQL session-level advisory lock
+// (see pg_try_advisory_lock)
+// on that connection for every lease it grants.
+// Lease names are hashed (together with the table name) to advisory-lock keys.
+// The table is still used for secrets and expiration times,
+// and gets an extra column recording which leases were granted without an advisory lock
+// (see below).
+//
+// The difference from the default, table-only mode is in what happens when a holder crashes.
+// In table-only mode, a lease whose holder disappears remains held until its expiration time.
+// In advisory-lock mode, PostgresQL drops the advisory locks the moment the dedicated connection dies,
+// so the leases granted through this provider become available to other providers immediately,
+// regardless of their expiration times.
+// Conversely, once the connection is lost, every subsequent call on this provider fails.
+//
+// A lease that expires without being released,
+// or that is broken through another provider (see [Provider.Break]),
+// keeps its advisory lock until this provider next notices
+// (on its next Acquire of the same name, a failed Renew, or garbage collection)
+// or until its connection closes.
+// In the meantime other providers can still acquire the lease,
+// but only as in table-only mode, without an advisory lock;
+// if such a holder crashes,
+// the lease remains held until its expiration time.
+// Acquiring an expired lease through the same provider works as in table-only mode.
+//
+// Do not mix table-only and advisory-lock providers on the same table.
+func WithAdvisoryLocks() Option {
+	return func(p *Provider) {
+		p.advisory = true
+	}
+}
+
+var errClosed = errors.New("provider is closed")
+
+// addUnlockedFmt adds to the lease table the column used only in advisory-lock mode.
+// It is true in the rows of leases granted without an advisory lock,
+// which are not left over from a dead session
+// and so must not be overwritten by the next holder of the lock
+// until they expire.
+const addUnlockedFmt = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS unlocked BOOLEAN NOT NULL DEFAULT FALSE`
+
+// lockKey maps a lease name to a PostgresQL advisory-lock key.
+func lockKey(table, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(table))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// acquireAdvisory acquires a lease in advisory-lock mode.
+func (p *Provider) acquireAdvisory(ctx context.Context, name, secret string, expSecs int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return errClosed
+	}
+
+	if _, ok := p.locked[name]; ok {
+		// This session already holds the advisory lock
+		// (which is reentrant, so must not be taken twice).
+		// The lease is available only if it has expired.
+		if err := p.acquireRow(ctx, name, secret, expSecs, false); err != nil {
+			return err
+		}
+		p.locked[name] = secret
+		return nil
+	}
+
+	var ok bool
+	if err := p.conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey(p.table, name)).Scan(&ok); err != nil {
+		return errors.Wrapf(err, "locking lease %s", name)
+	}
+	if !ok {
+		// Another session holds the advisory lock,
+		// but its lease may have expired or been broken without its noticing.
+		// In that case the lease is available as in table-only mode.
+		return p.acquireRow(ctx, name, secret, expSecs, true)
+	}
+
+	// Holding the advisory lock means any existing row for this name
+	// is left over from a holder whose session has ended,
+	// unless it was granted without the lock and has not expired.
+	const qfmt = `
+		INSERT INTO %[1]s (name, secret, exp_secs, unlocked) VALUES ($1, $2, $3, FALSE)
+			ON CONFLICT (name) DO UPDATE SET secret = $2, exp_secs = $3, unlocked = FALSE
+				WHERE %[1]s.exp_secs < %[2]s OR NOT %[1]s.unlocked`
+	q, qargs := p.queryWithExpSecs(qfmt, []any{name, secret, expSecs})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, pgsql.AcquireEvent, "exp_secs")
+	}
+
+	res, err := p.conn.ExecContext(ctx, q, qargs...)
+	if err == nil {
+		var aff int64
+		aff, err = res.RowsAffected()
+		if err == nil && aff == 0 {
+			err = lease.ErrHeld
+		}
+	}
+	if err != nil {
+		_ = p.unlock(ctx, name)
+		if errors.Is(err, lease.ErrHeld) {
+			return err
+		}
+		return errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	p.locked[name] = secret
+
+	return nil
+}
+
+// acquireRow acquires a lease in the table alone,
+// as in table-only mode,
+// recording whether it is granted without an advisory lock.
+//
+// Precondition: the caller must hold the mutex.
+func (p *Provider) acquireRow(ctx context.Context, name, secret string, expSecs int64, unlocked bool) error {
+	const qfmt = `
+		INSERT INTO %[1]s (name, secret, exp_secs, unlocked) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (name) DO UPDATE SET secret = $2, exp_secs = $3, unlocked = $4
+				WHERE %[1]s.exp_secs < %[2]s`
+	q, qargs := p.queryWithExpSecs(qfmt, []any{name, secret, expSecs, unlocked})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, pgsql.AcquireEvent, "exp_secs")
+	}
+
+	res, err := p.conn.ExecContext(ctx, q, qargs...)
+	if err != nil {
+		return errors.Wrapf(err, "acquiring lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return lease.ErrHeld
+	}
+	return nil
+}
+
+func (p *Provider) renewAdvisory(ctx context.Context, name, q string, qargs ...any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return errClosed
+	}
+
+	res, err := p.conn.ExecContext(ctx, q, qargs...)
+	if err != nil {
+		return errors.Wrapf(err, "renewing lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		if err := p.unlockIfStale(ctx, name); err != nil {
+			return errors.Wrapf(err, "checking lease %s", name)
+		}
+		return lease.ErrNotHeld
+	}
+
+	return nil
+}
+
+func (p *Provider) releaseAdvisory(ctx context.Context, name, q string, qargs ...any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return errClosed
+	}
+
+	res, err := p.conn.ExecContext(ctx, q, qargs...)
+	if err != nil {
+		return errors.Wrapf(err, "releasing lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return lease.ErrNotHeld
+	}
+
+	if _, ok := p.locked[name]; ok {
+		if err := p.unlock(ctx, name); err != nil {
+			return errors.Wrapf(err, "unlocking lease %s", name)
+		}
+	}
+
+	return nil
+}
+
+// unlockStale releases the advisory locks of leases that have expired,
+// or disappeared from the table,
+// or been replaced there by leases granted without the lock.
+func (p *Provider) unlockStale(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return
+	}
+
+	for name := range p.locked {
+		_ = p.unlockIfStale(ctx, name)
+	}
+}
+
+// Precondition: the caller must hold the mutex.
+func (p *Provider) unlockIfStale(ctx context.Context, name string) error {
+	secret, ok := p.locked[name]
+	if !ok {
+		return nil
+	}
+
+	const qfmt = `SELECT EXISTS (SELECT 1 FROM %s WHERE name = $1 AND secret = $2 AND exp_secs > %s)`
+	q, qargs := p.queryWithExpSecs(qfmt, []any{name, secret})
+
+	var live bool
+	if err := p.conn.QueryRowContext(ctx, q, qargs...).Scan(&live); err != nil {
+		return err
+	}
+	if live {
+		return nil
+	}
+	return p.unlock(ctx, name)
+}
+
+// Precondition: the caller must hold the mutex.
+func (p *Provider) unlock(ctx context.Context, name string) error {
+	if _, err := p.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey(p.table, name)); err != nil {
+		return err
+	}
+	delete(p.locked, name)
+	return nil
+}
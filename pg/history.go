@@ -0,0 +1,74 @@
+package pg
+
+import (
+	"context"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/internal/pgsql"
+)
+
+var _ lease.Historian = &Provider{}
+
+// WithHistory is an [Option] that makes the provider keep an audit trail of lease events
+// in a table with the given name.
+// The table is created if it does not already exist.
+//
+// Each event is recorded in the same statement as the change it describes,
+// so the trail cannot disagree with the lease table.
+// Expired leases deleted by garbage collection (see [Provider.GC]) are recorded as [lease.EventExpire].
+//
+// See [Provider.History].
+func WithHistory(table string) Option {
+	return func(p *Provider) {
+		p.history = table
+	}
+}
+
+func (p *Provider) createHistory(ctx context.Context) error {
+	for _, q := range pgsql.CreateHistory(p.history) {
+		if _, err := p.db.ExecContext(ctx, q); err != nil {
+			return errors.Wrapf(err, "creating table %s", p.history)
+		}
+	}
+	return nil
+}
+
+// logged wraps q, a data-modifying statement on the lease table,
+// in a statement that also records an event in the history table.
+// See [pgsql.Logged].
+func (p *Provider) logged(ctx context.Context, q string, qargs []any, event, exp string) (string, []any) {
+	return pgsql.Logged(p.Clock, p.history, lease.Holder(ctx), "", q, qargs, event, exp)
+}
+
+// History implements [lease.Historian].
+// It requires the provider to have been created with [WithHistory].
+func (p *Provider) History(ctx context.Context, hq lease.HistoryQuery) ([]lease.Event, error) {
+	if p.history == "" {
+		return nil, errors.New("history not enabled")
+	}
+
+	q, qargs := pgsql.History(p.history, hq)
+
+	rows, err := p.db.QueryContext(ctx, q, qargs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying history")
+	}
+	defer rows.Close()
+
+	var result []lease.Event
+	for rows.Next() {
+		var (
+			name, evtype, holder, reason string
+			atSecs                       int64
+			expSecs                      *int64
+		)
+		if err := rows.Scan(&name, &evtype, &holder, &atSecs, &expSecs, &reason); err != nil {
+			return nil, errors.Wrap(err, "scanning history row")
+		}
+		result = append(result, pgsql.Event(name, evtype, holder, atSecs, expSecs, reason))
+	}
+
+	return result, errors.Wrap(rows.Err(), "iterating over history rows")
+}
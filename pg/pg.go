@@ -3,15 +3,18 @@ package pg
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/bobg/errors"
 
-	"github.com/bobg/lease"
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/internal/deadline"
+	"github.com/bobg/lease/v2/internal/gc"
+	"github.com/bobg/lease/v2/internal/pgsql"
+	"github.com/bobg/lease/v2/internal/secrets"
 )
 
 // Provider is a lease.Provider implemented in terms of a PostgresQL database.
@@ -20,52 +23,69 @@ type Provider struct {
 
 	table string // name of the table that stores leases
 	db    *sql.DB
-	done  chan struct{}
+
+	history string // name of the table that stores the audit trail, if any
+
+	gcConfig  gc.Config
+	collector gc.Collector // runs GC in the background
+
+	// These fields are used only in advisory-lock mode.
+	// See [WithAdvisoryLocks].
+	advisory bool
+	conn     *sql.Conn // dedicated connection holding the advisory locks
+	mu       sync.Mutex
+	locked   map[string]string // names whose advisory locks are held on conn, with the secrets of the leases granted under them
 }
 
-var _ lease.Provider = &Provider{}
+var (
+	_ lease.Provider    = &Provider{}
+	_ lease.Inspector   = &Provider{}
+	_ lease.Breaker     = &Provider{}
+	_ lease.Transferer  = &Provider{}
+	_ lease.TTLProvider = &Provider{}
+)
 
 // New creates a new PostgresQL lease provider.
 // Leases are stored in a table with the given name.
 // The table is created if it does not already exist.
 func New(ctx context.Context, db *sql.DB, table string, opts ...Option) (*Provider, error) {
-	const qfmt = `CREATE TABLE IF NOT EXISTS %s (
-		name TEXT NOT NULL PRIMARY KEY,
-		secret TEXT NOT NULL,
-		exp_secs BIGINT NOT NULL
-	)`
-	q := fmt.Sprintf(qfmt, table)
-
-	if _, err := db.ExecContext(ctx, q); err != nil {
+	if _, err := db.ExecContext(ctx, pgsql.CreateTable(table)); err != nil {
 		return nil, errors.Wrapf(err, "creating table %s", table)
 	}
 
-	ch := make(chan struct{})
-
 	p := &Provider{
-		Clock: lease.DefaultClock{},
-		table: table,
-		db:    db,
-		done:  ch,
+		Clock:    lease.DefaultClock{},
+		table:    table,
+		db:       db,
+		gcConfig: gc.Config{Interval: DefaultGCInterval},
 	}
 
 	for _, opt := range opts {
 		opt(p)
 	}
 
-	go func() {
-		for {
-			select {
-			case <-ch:
-				return
+	if p.history != "" {
+		if err := p.createHistory(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.advisory {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(addUnlockedFmt, table)); err != nil {
+			return nil, errors.Wrapf(err, "adding column to table %s", table)
+		}
 
-			case <-p.After(5 * time.Minute):
-				const qfmt = `DELETE FROM %s WHERE exp_secs < %s`
-				q, qargs := p.queryWithExpSecs(qfmt, nil)
-				_, _ = db.ExecContext(ctx, q, qargs...)
-			}
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening dedicated connection")
 		}
-	}()
+		p.conn = conn
+		p.locked = make(map[string]string)
+	}
+
+	// The caller's context governs only the construction of p.
+	// The garbage collector runs until Close is called.
+	p.collector.Start(ctx, p.Clock, p.gcConfig, p.GC)
 
 	return p, nil
 }
@@ -80,50 +100,141 @@ func WithClock(c lease.Clock) Option {
 	}
 }
 
-// Close releases resources held by the provider.
+// DefaultGCInterval is how often a [Provider] deletes expired leases
+// unless overridden with [WithGCInterval].
+const DefaultGCInterval = gc.DefaultInterval
+
+// WithGCInterval is an [Option] that sets how often the provider deletes expired leases from its table.
+// A value of zero or less disables the background garbage collector;
+// expired leases can still be deleted on demand with [Provider.GC].
+func WithGCInterval(d time.Duration) Option {
+	return func(p *Provider) {
+		p.gcConfig.Interval = d
+	}
+}
+
+// WithGCBatchSize is an [Option] that limits how many expired leases a single DELETE statement removes.
+// Garbage collection issues as many statements as needed.
+// A value of zero or less (the default) means no limit.
+func WithGCBatchSize(n int) Option {
+	return func(p *Provider) {
+		p.gcConfig.Batch = n
+	}
+}
+
+// WithGCHook is an [Option] that sets a function to call after each run of the background garbage collector
+// with the number of expired leases deleted and the error, if any.
+func WithGCHook(f func(deleted int64, err error)) Option {
+	return func(p *Provider) {
+		p.gcConfig.Hook = f
+	}
+}
+
+// GC deletes expired leases from the provider's table,
+// returning the number deleted.
+// It is called periodically in the background unless disabled with [WithGCInterval],
+// but may also be called directly.
+func (p *Provider) GC(ctx context.Context) (int64, error) {
+	var total int64
+
+	for {
+		var (
+			q     string
+			qargs []any
+		)
+		if p.gcConfig.Batch > 0 {
+			q, qargs = p.queryWithExpSecs(pgsql.GCBatchFmt, []any{p.gcConfig.Batch})
+		} else {
+			q, qargs = p.queryWithExpSecs(pgsql.GCFmt, nil)
+		}
+
+		if p.history != "" {
+			q, qargs = p.logged(ctx, q, qargs, `'expire'`, "exp_secs")
+		}
+
+		res, err := p.db.ExecContext(ctx, q, qargs...)
+		if err != nil {
+			return total, errors.Wrap(err, "deleting expired leases")
+		}
+		aff, err := res.RowsAffected()
+		if err != nil {
+			return total, errors.Wrap(err, "counting affected rows")
+		}
+		total += aff
+
+		if p.gcConfig.Batch <= 0 || aff < int64(p.gcConfig.Batch) {
+			break
+		}
+	}
+
+	if p.advisory {
+		p.unlockStale(ctx)
+	}
+
+	return total, nil
+}
+
+// Close releases resources held by the provider,
+// waiting for the background garbage collector (if any) to exit.
 // However, it does _not_ close the underlying database connection.
+//
+// In advisory-lock mode (see [WithAdvisoryLocks]),
+// Close also releases every lease held through this provider.
 func (p *Provider) Close() {
-	if p.done != nil {
-		close(p.done)
-		p.done = nil // make this call idempotent
+	p.collector.Stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		// Returning the connection to the pool does not end its session,
+		// so the advisory locks must be dropped explicitly.
+		_, _ = p.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock_all()`)
+		_ = p.conn.Close()
+		p.conn = nil
+		p.locked = nil
 	}
 }
 
-func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, error) {
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
 	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
 		exp = deadline
 	}
 	deadlineSecs := exp.Unix()
 
-	var secretBytes [16]byte
-	if _, err := rand.Read(secretBytes[:]); err != nil {
-		return "", errors.Wrap(err, "generating secret")
+	secret, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
 	}
-	secret := hex.EncodeToString(secretBytes[:])
 
-	const qfmt = `
-		INSERT INTO %s (name, secret, exp_secs) VALUES ($1, $2, $3)
-			ON CONFLICT (name) DO UPDATE SET secret = $2, exp_secs = $3
-				WHERE leases.exp_secs < %s`
+	if p.advisory {
+		if err := p.acquireAdvisory(ctx, name, secret, deadlineSecs); err != nil {
+			return "", time.Time{}, err
+		}
+		return secret, time.Unix(deadlineSecs, 0), nil
+	}
 
-	q, qargs := p.queryWithExpSecs(qfmt, []any{name, secret, deadlineSecs})
+	q, qargs := p.queryWithExpSecs(pgsql.AcquireFmt, []any{name, secret, deadlineSecs})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, pgsql.AcquireEvent, "exp_secs")
+	}
 
 	res, err := p.db.ExecContext(ctx, q, qargs...)
 	if err != nil {
-		return "", errors.Wrapf(err, "acquiring lease %s", name)
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
 	}
 	aff, err := res.RowsAffected()
 	if err != nil {
-		return "", errors.Wrap(err, "counting affected rows")
+		return "", time.Time{}, errors.Wrap(err, "counting affected rows")
 	}
 	if aff == 0 {
-		return "", lease.ErrHeld
+		return "", time.Time{}, lease.ErrHeld
 	}
 
-	return secret, nil
+	return secret, time.Unix(deadlineSecs, 0), nil
 }
 
-func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) error {
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
 	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
 		exp = deadline
 	}
@@ -133,12 +244,119 @@ func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time
 		nowSecs = p.Now().Unix()
 	)
 
-	const qfmt = `UPDATE %s SET exp_secs = $1 WHERE name = $2 AND secret = $3 AND exp_secs > $4`
-	q := fmt.Sprintf(qfmt, p.table)
+	var (
+		q     = fmt.Sprintf(pgsql.RenewFmt, p.table)
+		qargs = []any{expSecs, name, secret, nowSecs}
+	)
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'renew'`, "exp_secs")
+	}
+
+	if p.advisory {
+		if err := p.renewAdvisory(ctx, name, q, qargs...); err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(expSecs, 0), nil
+	}
 
-	res, err := p.db.ExecContext(ctx, q, expSecs, name, secret, nowSecs)
+	res, err := p.db.ExecContext(ctx, q, qargs...)
 	if err != nil {
-		return errors.Wrapf(err, "renewing lease %s", name)
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	return time.Unix(expSecs, 0), nil
+}
+
+// AcquireTTL implements [lease.TTLProvider].
+// When the provider uses the default clock (see [WithClock]),
+// the expiration time is computed from the database server's clock.
+//
+// AcquireTTL and RenewTTL are not supported in advisory-lock mode (see [WithAdvisoryLocks]);
+// they fail there with [errors.ErrUnsupported].
+func (p *Provider) AcquireTTL(ctx context.Context, name string, ttl time.Duration) (string, time.Time, error) {
+	if p.advisory {
+		return "", time.Time{}, errors.Wrap(errors.ErrUnsupported, "cannot compute expiration times in advisory-lock mode")
+	}
+
+	ttl, err := deadline.ClampTTL(ctx, p.Clock, ttl)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	secret, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	q, qargs := p.queryWithExpSecs(pgsql.AcquireTTLFmt, []any{name, secret, ttl.Seconds()})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, pgsql.AcquireEvent, "exp_secs")
+	}
+
+	var expSecs int64
+	err = p.db.QueryRowContext(ctx, pgsql.ReturningExp(q), qargs...).Scan(&expSecs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, time.Unix(expSecs, 0), nil
+}
+
+// RenewTTL implements [lease.TTLProvider].
+// See [Provider.AcquireTTL].
+func (p *Provider) RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error) {
+	if p.advisory {
+		return time.Time{}, errors.Wrap(errors.ErrUnsupported, "cannot compute expiration times in advisory-lock mode")
+	}
+
+	ttl, err := deadline.ClampTTL(ctx, p.Clock, ttl)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+
+	q, qargs := p.queryWithExpSecs(pgsql.RenewTTLFmt, []any{ttl.Seconds(), name, secret})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'renew'`, "exp_secs")
+	}
+
+	var expSecs int64
+	err = p.db.QueryRowContext(ctx, pgsql.ReturningExp(q), qargs...).Scan(&expSecs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+
+	return time.Unix(expSecs, 0), nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	var (
+		q     = fmt.Sprintf(pgsql.ReleaseFmt, p.table)
+		qargs = []any{name, secret}
+	)
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'release'`, "NULL")
+	}
+
+	if p.advisory {
+		return p.releaseAdvisory(ctx, name, q, qargs...)
+	}
+
+	res, err := p.db.ExecContext(ctx, q, qargs...)
+	if err != nil {
+		return errors.Wrapf(err, "releasing lease %s", name)
 	}
 	aff, err := res.RowsAffected()
 	if err != nil {
@@ -151,13 +369,67 @@ func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time
 	return nil
 }
 
-func (p *Provider) Release(ctx context.Context, name, secret string) error {
-	const qfmt = `DELETE FROM %s WHERE name = $1 AND secret = $2`
-	q := fmt.Sprintf(qfmt, p.table)
+// Transfer implements [lease.Transferer].
+//
+// Transfer is not supported in advisory-lock mode (see [WithAdvisoryLocks]),
+// where a lease is tied to the connection of the provider that granted it;
+// it fails there with [errors.ErrUnsupported].
+func (p *Provider) Transfer(ctx context.Context, name, secret string, exp time.Time) (string, time.Time, error) {
+	if p.advisory {
+		return "", time.Time{}, errors.Wrap(errors.ErrUnsupported, "cannot transfer leases in advisory-lock mode")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
 
-	res, err := p.db.ExecContext(ctx, q, name, secret)
+	next, err := secrets.New()
 	if err != nil {
-		return errors.Wrapf(err, "releasing lease %s", name)
+		return "", time.Time{}, err
+	}
+
+	q, qargs := p.queryWithExpSecs(pgsql.TransferFmt, []any{next, exp.Unix(), name, secret})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'transfer'`, "exp_secs")
+	}
+
+	res, err := p.db.ExecContext(ctx, q, qargs...)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "transferring lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return "", time.Time{}, lease.ErrNotHeld
+	}
+
+	return next, time.Unix(exp.Unix(), 0), nil
+}
+
+// Break implements [lease.Breaker].
+//
+// In advisory-lock mode,
+// a lease broken through a provider other than the one that granted it
+// is available again only without an advisory lock
+// (see [WithAdvisoryLocks])
+// until its holder notices (at its next Renew or garbage collection)
+// or its connection closes.
+func (p *Provider) Break(ctx context.Context, name, reason string) error {
+	q, qargs := p.queryWithExpSecs(pgsql.BreakFmt, []any{name})
+	if p.history != "" {
+		q, qargs = pgsql.Logged(p.Clock, p.history, lease.Holder(ctx), reason, q, qargs, `'break'`, "NULL")
+	}
+
+	if p.advisory {
+		// Breaking is releasing without the secret.
+		return p.releaseAdvisory(ctx, name, q, qargs...)
+	}
+
+	res, err := p.db.ExecContext(ctx, q, qargs...)
+	if err != nil {
+		return errors.Wrapf(err, "breaking lease %s", name)
 	}
 	aff, err := res.RowsAffected()
 	if err != nil {
@@ -170,17 +442,46 @@ func (p *Provider) Release(ctx context.Context, name, secret string) error {
 	return nil
 }
 
+// Inspect implements [lease.Inspector].
+func (p *Provider) Inspect(ctx context.Context, name string) (lease.Info, bool, error) {
+	q, qargs := p.queryWithExpSecs(pgsql.InspectFmt, []any{name})
+
+	var expSecs int64
+	err := p.db.QueryRowContext(ctx, q, qargs...).Scan(&expSecs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return lease.Info{}, false, nil
+	}
+	if err != nil {
+		return lease.Info{}, false, errors.Wrapf(err, "inspecting lease %s", name)
+	}
+	return lease.Info{Name: name, Exp: time.Unix(expSecs, 0)}, true, nil
+}
+
+// List implements [lease.Inspector].
+func (p *Provider) List(ctx context.Context, prefix string) ([]lease.Info, error) {
+	q, qargs := p.queryWithExpSecs(pgsql.ListFmt, []any{prefix})
+
+	rows, err := p.db.QueryContext(ctx, q, qargs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing leases")
+	}
+	defer rows.Close()
+
+	var result []lease.Info
+	for rows.Next() {
+		var (
+			name    string
+			expSecs int64
+		)
+		if err := rows.Scan(&name, &expSecs); err != nil {
+			return nil, errors.Wrap(err, "scanning lease row")
+		}
+		result = append(result, lease.Info{Name: name, Exp: time.Unix(expSecs, 0)})
+	}
+
+	return result, errors.Wrap(rows.Err(), "iterating over lease rows")
+}
+
 func (p *Provider) queryWithExpSecs(qfmt string, qargs []any) (string, []any) {
-	fmtargs := []any{p.table}
-
-	if _, ok := p.Clock.(lease.DefaultClock); ok {
-		// OK to rely on the server's clock.
-		fmtargs = append(fmtargs, "EXTRACT(EPOCH FROM NOW())")
-	} else {
-		// Do not rely on the server's clock.
-		fmtargs = append(fmtargs, fmt.Sprintf("$%d", len(qargs)+1))
-		qargs = append(qargs, p.Now().Unix())
-	}
-	q := fmt.Sprintf(qfmt, fmtargs...)
-	return q, qargs
+	return pgsql.Query(p.Clock, p.table, qfmt, qargs)
 }
@@ -3,6 +3,7 @@ package pg
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"slices"
@@ -12,13 +13,13 @@ import (
 	"github.com/benbjohnson/clock"
 	_ "github.com/lib/pq"
 
-	"github.com/bobg/lease"
-	"github.com/bobg/lease/testutil"
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
 )
 
-func factory(ctx context.Context, db *sql.DB, table string) func(lease.Clock) (lease.Provider, error) {
+func factory(ctx context.Context, db *sql.DB, table string, opts ...Option) func(lease.Clock) (lease.Provider, error) {
 	return func(clock lease.Clock) (lease.Provider, error) {
-		return New(ctx, db, table, WithClock(clock))
+		return New(ctx, db, table, append(opts, WithClock(clock))...)
 	}
 }
 
@@ -38,6 +39,387 @@ func TestLeader(t *testing.T) {
 	})
 }
 
+func TestAdvisoryProvider(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		testutil.Provider(ctx, t, factory(ctx, db, "advisory_leases", WithAdvisoryLocks()))
+	})
+}
+
+func TestAdvisoryLeader(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		testutil.Leader(ctx, t, factory(ctx, db, "advisory_leases", WithAdvisoryLocks()))
+	})
+}
+
+func TestAdvisoryCrash(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		p1, err := New(ctx, db, "advisory_leases", WithAdvisoryLocks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p1.Close()
+
+		p2, err := New(ctx, db, "advisory_leases", WithAdvisoryLocks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p2.Close()
+
+		exp := time.Now().Add(time.Hour)
+
+		if _, _, err := p1.Acquire(ctx, "crash", exp); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p2.Acquire(ctx, "crash", exp); !errors.Is(err, lease.ErrHeld) {
+			t.Fatalf("got error %v, want ErrHeld", err)
+		}
+
+		// Simulate a crash by terminating p1's session.
+		var pid int
+		if err := p1.conn.QueryRowContext(ctx, `SELECT pg_backend_pid()`).Scan(&pid); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, `SELECT pg_terminate_backend($1)`, pid); err != nil {
+			t.Fatal(err)
+		}
+
+		// Termination is asynchronous.
+		for i := 0; ; i++ {
+			secret, _, err := p2.Acquire(ctx, "crash", exp)
+			if err == nil {
+				defer p2.Release(ctx, "crash", secret)
+				break
+			}
+			if !errors.Is(err, lease.ErrHeld) || i >= 50 {
+				t.Fatalf("acquiring lease after crash: %v", err)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+}
+
+func TestAdvisoryBreak(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS advisory_break_leases"); err != nil {
+			t.Fatal(err)
+		}
+
+		p1, err := New(ctx, db, "advisory_break_leases", WithAdvisoryLocks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p1.Close()
+
+		p2, err := New(ctx, db, "advisory_break_leases", WithAdvisoryLocks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p2.Close()
+
+		exp := time.Now().Add(time.Hour)
+
+		secret1, _, err := p1.Acquire(ctx, "break", exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Break the lease through the provider that does not hold its advisory lock.
+		if err := p2.Break(ctx, "break", "wedged"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The lease is available even though p1 still holds the advisory lock.
+		secret2, _, err := p2.Acquire(ctx, "break", exp)
+		if err != nil {
+			t.Fatalf("acquiring broken lease: %v", err)
+		}
+		defer p2.Release(ctx, "break", secret2)
+
+		// Renewing fails, and p1 drops its advisory lock.
+		if _, err := p1.Renew(ctx, "break", secret1, exp); !errors.Is(err, lease.ErrNotHeld) {
+			t.Fatalf("got error %v, want ErrNotHeld", err)
+		}
+
+		// Now p1 can get the advisory lock, but must not take over p2's lease.
+		if _, _, err := p1.Acquire(ctx, "break", exp); !errors.Is(err, lease.ErrHeld) {
+			t.Fatalf("got error %v, want ErrHeld", err)
+		}
+
+		if _, err := p2.Renew(ctx, "break", secret2, exp); err != nil {
+			t.Fatalf("renewing lease acquired without the advisory lock: %v", err)
+		}
+	})
+}
+
+func TestAdvisoryExpired(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS advisory_expired_leases"); err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			mockClock = clock.NewMock()
+			t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+		)
+		mockClock.Set(t0)
+
+		p1, err := New(ctx, db, "advisory_expired_leases", WithAdvisoryLocks(), WithClock(mockClock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p1.Close()
+
+		p2, err := New(ctx, db, "advisory_expired_leases", WithAdvisoryLocks(), WithClock(mockClock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p2.Close()
+
+		if _, _, err := p1.Acquire(ctx, "expired", t0.Add(10*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p2.Acquire(ctx, "expired", t0.Add(20*time.Second)); !errors.Is(err, lease.ErrHeld) {
+			t.Fatalf("got error %v, want ErrHeld", err)
+		}
+
+		mockClock.Add(15 * time.Second) // t0+15s
+
+		// The lease has expired, though p1's session still holds the advisory lock.
+		secret, _, err := p2.Acquire(ctx, "expired", t0.Add(30*time.Second))
+		if err != nil {
+			t.Fatalf("acquiring expired lease: %v", err)
+		}
+		defer p2.Release(ctx, "expired", secret)
+
+		if _, _, err := p1.Acquire(ctx, "expired", t0.Add(30*time.Second)); !errors.Is(err, lease.ErrHeld) {
+			t.Fatalf("got error %v, want ErrHeld", err)
+		}
+	})
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		for _, table := range []string{"history_leases", "history"} {
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.History(ctx, t, factory(ctx, db, "history_leases", WithHistory("history")))
+	})
+}
+
+func TestInspector(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS inspect_leases"); err != nil {
+			t.Fatal(err)
+		}
+		testutil.Inspector(ctx, t, factory(ctx, db, "inspect_leases"))
+	})
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		for _, table := range []string{"break_leases", "break_history"} {
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.Breaker(ctx, t, factory(ctx, db, "break_leases", WithHistory("break_history")))
+	})
+}
+
+func TestTransferer(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		for _, table := range []string{"transfer_leases", "transfer_history"} {
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.Transferer(ctx, t, factory(ctx, db, "transfer_leases", WithHistory("transfer_history")))
+	})
+}
+
+// TestTTLServerClock tests the TTL methods with the default clock,
+// where expiration times come from the database server's clock.
+func TestTTLServerClock(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS ttl_server_leases"); err != nil {
+			t.Fatal(err)
+		}
+		p, err := New(ctx, db, "ttl_server_leases")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before := time.Now()
+		secret, exp, err := p.AcquireTTL(ctx, "ttl-server", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Release(ctx, "ttl-server", secret)
+		if lo, hi := before.Add(time.Minute-5*time.Second), time.Now().Add(time.Minute+5*time.Second); exp.Before(lo) || exp.After(hi) {
+			t.Errorf("got expiration time %s, want between %s and %s", exp, lo, hi)
+		}
+
+		renewed, err := p.RenewTTL(ctx, "ttl-server", secret, 2*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !renewed.After(exp) {
+			t.Errorf("got expiration time %s after renewing, want later than %s", renewed, exp)
+		}
+
+		expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+		defer cancel()
+		if _, err := p.RenewTTL(expired, "ttl-server", secret, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("renewing with expired deadline: got error %v, want DeadlineExceeded", err)
+		}
+	})
+}
+
+// TestTTLRounding checks that expiration times computed from the database server's clock
+// are no earlier than the requested TTL from when the call began.
+func TestTTLRounding(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS ttl_rounding_leases"); err != nil {
+			t.Fatal(err)
+		}
+		p, err := New(ctx, db, "ttl_rounding_leases")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serverNow := func() time.Time {
+			var secs float64
+			if err := db.QueryRowContext(ctx, `SELECT EXTRACT(EPOCH FROM NOW())::DOUBLE PRECISION`).Scan(&secs); err != nil {
+				t.Fatal(err)
+			}
+			return time.Unix(0, int64(secs*float64(time.Second)))
+		}
+
+		const ttl = 1500 * time.Millisecond
+
+		before := serverNow()
+		secret, exp, err := p.AcquireTTL(ctx, "ttl-rounding", ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Release(ctx, "ttl-rounding", secret)
+		if want := before.Add(ttl); exp.Before(want) {
+			t.Errorf("got expiration time %s from AcquireTTL, want at least %s", exp, want)
+		}
+
+		before = serverNow()
+		exp, err = p.RenewTTL(ctx, "ttl-rounding", secret, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := before.Add(ttl); exp.Before(want) {
+			t.Errorf("got expiration time %s from RenewTTL, want at least %s", exp, want)
+		}
+	})
+}
+
+func TestTTLProvider(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		for _, table := range []string{"ttl_leases", "ttl_history"} {
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.TTLProvider(ctx, t, factory(ctx, db, "ttl_leases", WithHistory("ttl_history")))
+	})
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+
+	withDB(ctx, t, func(db *sql.DB) {
+		var (
+			mockClock = clock.NewMock()
+			t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+			hookCh    = make(chan int64, 1)
+		)
+		mockClock.Set(t0)
+
+		hook := func(n int64, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			hookCh <- n
+		}
+
+		p, err := New(ctx, db, "gc_leases", WithClock(mockClock), WithGCInterval(time.Minute), WithGCBatchSize(2), WithGCHook(hook))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+
+		for i := 0; i < 5; i++ {
+			if _, _, err := p.Acquire(ctx, fmt.Sprintf("gc%d", i), t0.Add(10*time.Second)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n, err := p.GC(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("got %d deleted before expiry, want 0", n)
+		}
+
+		mockClock.Add(20 * time.Second)
+
+		n, err = p.GC(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 {
+			t.Errorf("got %d deleted after expiry, want 5", n)
+		}
+
+		if _, _, err := p.Acquire(ctx, "gc-bg", t0.Add(30*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		mockClock.Add(time.Minute)
+
+		select {
+		case n := <-hookCh:
+			if n != 1 {
+				t.Errorf("got %d deleted in background, want 1", n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for background garbage collection")
+		}
+	})
+}
+
 func withDB(ctx context.Context, t *testing.T, f func(*sql.DB)) {
 	var (
 		dbhost   = os.Getenv("POSTGRES_HOST")
@@ -0,0 +1,418 @@
+// Package pgx implements [lease.Provider] in terms of a PostgresQL database
+// accessed through a [pgxpool.Pool].
+//
+// It uses the same schema and has the same semantics as the provider in github.com/bobg/lease/v2/pg,
+// so the two can share lease tables.
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bobg/errors"
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/internal/deadline"
+	"github.com/bobg/lease/v2/internal/gc"
+	"github.com/bobg/lease/v2/internal/pgsql"
+	"github.com/bobg/lease/v2/internal/secrets"
+)
+
+// Provider is a lease.Provider implemented in terms of a [pgxpool.Pool].
+//
+// Its queries depend only on the table names and the clock,
+// so the pool's statement cache
+// (in pgx's default query-execution mode)
+// prepares each one once per connection and reuses it thereafter.
+type Provider struct {
+	lease.Clock
+
+	table   string // name of the table that stores leases
+	history string // name of the table that stores the audit trail, if any
+	pool    *pgxpool.Pool
+
+	gcConfig  gc.Config
+	collector gc.Collector // runs GC in the background
+}
+
+var (
+	_ lease.Provider    = &Provider{}
+	_ lease.Historian   = &Provider{}
+	_ lease.Inspector   = &Provider{}
+	_ lease.Breaker     = &Provider{}
+	_ lease.Transferer  = &Provider{}
+	_ lease.TTLProvider = &Provider{}
+)
+
+// New creates a new PostgresQL lease provider using the given pool.
+// Leases are stored in a table with the given name.
+// The table (and the history table, if any; see [WithHistory])
+// is created if it does not already exist.
+func New(ctx context.Context, pool *pgxpool.Pool, table string, opts ...Option) (*Provider, error) {
+	p := &Provider{
+		Clock:    lease.DefaultClock{},
+		table:    table,
+		pool:     pool,
+		gcConfig: gc.Config{Interval: DefaultGCInterval},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	var batch pgxv5.Batch
+	batch.Queue(pgsql.CreateTable(table))
+	if p.history != "" {
+		for _, q := range pgsql.CreateHistory(p.history) {
+			batch.Queue(q)
+		}
+	}
+	if err := pool.SendBatch(ctx, &batch).Close(); err != nil {
+		return nil, errors.Wrapf(err, "creating table %s", table)
+	}
+
+	// The caller's context governs only the construction of p.
+	// The garbage collector runs until Close is called.
+	p.collector.Start(ctx, p.Clock, p.gcConfig, p.GC)
+
+	return p, nil
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// WithHistory is an [Option] that makes the provider keep an audit trail of lease events
+// in a table with the given name.
+// Each event is recorded in the same statement as the change it describes.
+// See [Provider.History].
+func WithHistory(table string) Option {
+	return func(p *Provider) {
+		p.history = table
+	}
+}
+
+// DefaultGCInterval is how often a [Provider] deletes expired leases
+// unless overridden with [WithGCInterval].
+const DefaultGCInterval = gc.DefaultInterval
+
+// WithGCInterval is an [Option] that sets how often the provider deletes expired leases from its table.
+// A value of zero or less disables the background garbage collector;
+// expired leases can still be deleted on demand with [Provider.GC].
+func WithGCInterval(d time.Duration) Option {
+	return func(p *Provider) {
+		p.gcConfig.Interval = d
+	}
+}
+
+// WithGCBatchSize is an [Option] that limits how many expired leases a single DELETE statement removes.
+// Garbage collection issues as many statements as needed.
+// A value of zero or less (the default) means no limit.
+func WithGCBatchSize(n int) Option {
+	return func(p *Provider) {
+		p.gcConfig.Batch = n
+	}
+}
+
+// WithGCHook is an [Option] that sets a function to call after each run of the background garbage collector
+// with the number of expired leases deleted and the error, if any.
+func WithGCHook(f func(deleted int64, err error)) Option {
+	return func(p *Provider) {
+		p.gcConfig.Hook = f
+	}
+}
+
+// Close stops the background garbage collector (if any) and waits for it to exit.
+// It does _not_ close the underlying pool.
+func (p *Provider) Close() {
+	p.collector.Stop()
+}
+
+// GC deletes expired leases from the provider's table,
+// returning the number deleted.
+// It is called periodically in the background unless disabled with [WithGCInterval],
+// but may also be called directly.
+func (p *Provider) GC(ctx context.Context) (int64, error) {
+	var total int64
+
+	for {
+		var (
+			q     string
+			qargs []any
+		)
+		if p.gcConfig.Batch > 0 {
+			q, qargs = pgsql.Query(p.Clock, p.table, pgsql.GCBatchFmt, []any{p.gcConfig.Batch})
+		} else {
+			q, qargs = pgsql.Query(p.Clock, p.table, pgsql.GCFmt, nil)
+		}
+		if p.history != "" {
+			q, qargs = p.logged(ctx, q, qargs, `'expire'`, "exp_secs")
+		}
+
+		tag, err := p.pool.Exec(ctx, q, qargs...)
+		if err != nil {
+			return total, errors.Wrap(err, "deleting expired leases")
+		}
+		aff := tag.RowsAffected()
+		total += aff
+
+		if p.gcConfig.Batch <= 0 || aff < int64(p.gcConfig.Batch) {
+			return total, nil
+		}
+	}
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	secret, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	q, qargs := pgsql.Query(p.Clock, p.table, pgsql.AcquireFmt, []any{name, secret, exp.Unix()})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, pgsql.AcquireEvent, "exp_secs")
+	}
+
+	tag, err := p.pool.Exec(ctx, q, qargs...)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", time.Time{}, lease.ErrHeld
+	}
+
+	return secret, time.Unix(exp.Unix(), 0), nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	var (
+		q     = fmt.Sprintf(pgsql.RenewFmt, p.table)
+		qargs = []any{exp.Unix(), name, secret, p.Now().Unix()}
+	)
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'renew'`, "exp_secs")
+	}
+
+	tag, err := p.pool.Exec(ctx, q, qargs...)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	if tag.RowsAffected() == 0 {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	return time.Unix(exp.Unix(), 0), nil
+}
+
+// AcquireTTL implements [lease.TTLProvider].
+// When the provider uses the default clock (see [WithClock]),
+// the expiration time is computed from the database server's clock.
+func (p *Provider) AcquireTTL(ctx context.Context, name string, ttl time.Duration) (string, time.Time, error) {
+	ttl, err := deadline.ClampTTL(ctx, p.Clock, ttl)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	secret, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	q, qargs := pgsql.Query(p.Clock, p.table, pgsql.AcquireTTLFmt, []any{name, secret, ttl.Seconds()})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, pgsql.AcquireEvent, "exp_secs")
+	}
+
+	var expSecs int64
+	err = p.pool.QueryRow(ctx, pgsql.ReturningExp(q), qargs...).Scan(&expSecs)
+	if errors.Is(err, pgxv5.ErrNoRows) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, time.Unix(expSecs, 0), nil
+}
+
+// RenewTTL implements [lease.TTLProvider].
+// See [Provider.AcquireTTL].
+func (p *Provider) RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error) {
+	ttl, err := deadline.ClampTTL(ctx, p.Clock, ttl)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+
+	q, qargs := pgsql.Query(p.Clock, p.table, pgsql.RenewTTLFmt, []any{ttl.Seconds(), name, secret})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'renew'`, "exp_secs")
+	}
+
+	var expSecs int64
+	err = p.pool.QueryRow(ctx, pgsql.ReturningExp(q), qargs...).Scan(&expSecs)
+	if errors.Is(err, pgxv5.ErrNoRows) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+
+	return time.Unix(expSecs, 0), nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	var (
+		q     = fmt.Sprintf(pgsql.ReleaseFmt, p.table)
+		qargs = []any{name, secret}
+	)
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'release'`, "NULL")
+	}
+
+	tag, err := p.pool.Exec(ctx, q, qargs...)
+	if err != nil {
+		return errors.Wrapf(err, "releasing lease %s", name)
+	}
+	if tag.RowsAffected() == 0 {
+		return lease.ErrNotHeld
+	}
+
+	return nil
+}
+
+// Transfer implements [lease.Transferer].
+func (p *Provider) Transfer(ctx context.Context, name, secret string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	next, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	q, qargs := pgsql.Query(p.Clock, p.table, pgsql.TransferFmt, []any{next, exp.Unix(), name, secret})
+	if p.history != "" {
+		q, qargs = p.logged(ctx, q, qargs, `'transfer'`, "exp_secs")
+	}
+
+	tag, err := p.pool.Exec(ctx, q, qargs...)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "transferring lease %s", name)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", time.Time{}, lease.ErrNotHeld
+	}
+
+	return next, time.Unix(exp.Unix(), 0), nil
+}
+
+// Break implements [lease.Breaker].
+func (p *Provider) Break(ctx context.Context, name, reason string) error {
+	q, qargs := pgsql.Query(p.Clock, p.table, pgsql.BreakFmt, []any{name})
+	if p.history != "" {
+		q, qargs = pgsql.Logged(p.Clock, p.history, lease.Holder(ctx), reason, q, qargs, `'break'`, "NULL")
+	}
+
+	tag, err := p.pool.Exec(ctx, q, qargs...)
+	if err != nil {
+		return errors.Wrapf(err, "breaking lease %s", name)
+	}
+	if tag.RowsAffected() == 0 {
+		return lease.ErrNotHeld
+	}
+
+	return nil
+}
+
+// Inspect implements [lease.Inspector].
+func (p *Provider) Inspect(ctx context.Context, name string) (lease.Info, bool, error) {
+	q, qargs := pgsql.Query(p.Clock, p.table, pgsql.InspectFmt, []any{name})
+
+	var expSecs int64
+	err := p.pool.QueryRow(ctx, q, qargs...).Scan(&expSecs)
+	if errors.Is(err, pgxv5.ErrNoRows) {
+		return lease.Info{}, false, nil
+	}
+	if err != nil {
+		return lease.Info{}, false, errors.Wrapf(err, "inspecting lease %s", name)
+	}
+	return lease.Info{Name: name, Exp: time.Unix(expSecs, 0)}, true, nil
+}
+
+// List implements [lease.Inspector].
+func (p *Provider) List(ctx context.Context, prefix string) ([]lease.Info, error) {
+	q, qargs := pgsql.Query(p.Clock, p.table, pgsql.ListFmt, []any{prefix})
+
+	rows, err := p.pool.Query(ctx, q, qargs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing leases")
+	}
+	defer rows.Close()
+
+	var result []lease.Info
+	for rows.Next() {
+		var (
+			name    string
+			expSecs int64
+		)
+		if err := rows.Scan(&name, &expSecs); err != nil {
+			return nil, errors.Wrap(err, "scanning lease row")
+		}
+		result = append(result, lease.Info{Name: name, Exp: time.Unix(expSecs, 0)})
+	}
+
+	return result, errors.Wrap(rows.Err(), "iterating over lease rows")
+}
+
+// History implements [lease.Historian].
+// It requires the provider to have been created with [WithHistory].
+func (p *Provider) History(ctx context.Context, hq lease.HistoryQuery) ([]lease.Event, error) {
+	if p.history == "" {
+		return nil, errors.New("history not enabled")
+	}
+
+	q, qargs := pgsql.History(p.history, hq)
+
+	rows, err := p.pool.Query(ctx, q, qargs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying history")
+	}
+	defer rows.Close()
+
+	var result []lease.Event
+	for rows.Next() {
+		var (
+			name, evtype, holder, reason string
+			atSecs                       int64
+			expSecs                      *int64
+		)
+		if err := rows.Scan(&name, &evtype, &holder, &atSecs, &expSecs, &reason); err != nil {
+			return nil, errors.Wrap(err, "scanning history row")
+		}
+		result = append(result, pgsql.Event(name, evtype, holder, atSecs, expSecs, reason))
+	}
+
+	return result, errors.Wrap(rows.Err(), "iterating over history rows")
+}
+
+func (p *Provider) logged(ctx context.Context, q string, qargs []any, event, exp string) (string, []any) {
+	return pgsql.Logged(p.Clock, p.history, lease.Holder(ctx), "", q, qargs, event, exp)
+}
@@ -0,0 +1,263 @@
+package pgx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/lib/pq"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/pg"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(ctx context.Context, pool *pgxpool.Pool, table string, opts ...Option) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(ctx, pool, table, append(opts, WithClock(clock))...)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		testutil.Provider(ctx, t, factory(ctx, pool, "pgx_leases"))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		testutil.Leader(ctx, t, factory(ctx, pool, "pgx_leases"))
+	})
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		for _, table := range []string{"pgx_history_leases", "pgx_history"} {
+			if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.History(ctx, t, factory(ctx, pool, "pgx_history_leases", WithHistory("pgx_history")))
+	})
+}
+
+func TestInspector(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS pgx_inspect_leases"); err != nil {
+			t.Fatal(err)
+		}
+		testutil.Inspector(ctx, t, factory(ctx, pool, "pgx_inspect_leases"))
+	})
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		for _, table := range []string{"pgx_break_leases", "pgx_break_history"} {
+			if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.Breaker(ctx, t, factory(ctx, pool, "pgx_break_leases", WithHistory("pgx_break_history")))
+	})
+}
+
+func TestTransferer(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		for _, table := range []string{"pgx_transfer_leases", "pgx_transfer_history"} {
+			if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.Transferer(ctx, t, factory(ctx, pool, "pgx_transfer_leases", WithHistory("pgx_transfer_history")))
+	})
+}
+
+// TestTTLServerClock tests the TTL methods with the default clock,
+// where expiration times come from the database server's clock.
+func TestTTLServerClock(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS pgx_ttl_server_leases"); err != nil {
+			t.Fatal(err)
+		}
+		p, err := New(ctx, pool, "pgx_ttl_server_leases")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before := time.Now()
+		secret, exp, err := p.AcquireTTL(ctx, "ttl-server", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Release(ctx, "ttl-server", secret)
+		if lo, hi := before.Add(time.Minute-5*time.Second), time.Now().Add(time.Minute+5*time.Second); exp.Before(lo) || exp.After(hi) {
+			t.Errorf("got expiration time %s, want between %s and %s", exp, lo, hi)
+		}
+
+		renewed, err := p.RenewTTL(ctx, "ttl-server", secret, 2*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !renewed.After(exp) {
+			t.Errorf("got expiration time %s after renewing, want later than %s", renewed, exp)
+		}
+
+		expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+		defer cancel()
+		if _, err := p.RenewTTL(expired, "ttl-server", secret, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("renewing with expired deadline: got error %v, want DeadlineExceeded", err)
+		}
+	})
+}
+
+// TestTTLRounding checks that expiration times computed from the database server's clock
+// are no earlier than the requested TTL from when the call began.
+func TestTTLRounding(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS pgx_ttl_rounding_leases"); err != nil {
+			t.Fatal(err)
+		}
+		p, err := New(ctx, pool, "pgx_ttl_rounding_leases")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serverNow := func() time.Time {
+			var secs float64
+			if err := pool.QueryRow(ctx, `SELECT EXTRACT(EPOCH FROM NOW())::DOUBLE PRECISION`).Scan(&secs); err != nil {
+				t.Fatal(err)
+			}
+			return time.Unix(0, int64(secs*float64(time.Second)))
+		}
+
+		const ttl = 1500 * time.Millisecond
+
+		before := serverNow()
+		secret, exp, err := p.AcquireTTL(ctx, "ttl-rounding", ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Release(ctx, "ttl-rounding", secret)
+		if want := before.Add(ttl); exp.Before(want) {
+			t.Errorf("got expiration time %s from AcquireTTL, want at least %s", exp, want)
+		}
+
+		before = serverNow()
+		exp, err = p.RenewTTL(ctx, "ttl-rounding", secret, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := before.Add(ttl); exp.Before(want) {
+			t.Errorf("got expiration time %s from RenewTTL, want at least %s", exp, want)
+		}
+	})
+}
+
+func TestTTLProvider(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, _ string) {
+		for _, table := range []string{"pgx_ttl_leases", "pgx_ttl_history"} {
+			if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testutil.TTLProvider(ctx, t, factory(ctx, pool, "pgx_ttl_leases", WithHistory("pgx_ttl_history")))
+	})
+}
+
+// TestInterop checks that this provider and the one in package pg can share a table.
+func TestInterop(t *testing.T) {
+	ctx := context.Background()
+
+	withPool(ctx, t, func(pool *pgxpool.Pool, dsn string) {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		p1, err := New(ctx, pool, "interop_leases")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p1.Close()
+
+		p2, err := pg.New(ctx, db, "interop_leases")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p2.Close()
+
+		exp := time.Now().Add(time.Minute)
+
+		secret, _, err := p1.Acquire(ctx, "interop", exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p2.Acquire(ctx, "interop", exp); !errors.Is(err, lease.ErrHeld) {
+			t.Errorf("got error %v, want ErrHeld", err)
+		}
+		if _, err := p2.Renew(ctx, "interop", secret, exp.Add(time.Minute)); err != nil {
+			t.Errorf("renewing through pg: %s", err)
+		}
+		if err := p2.Release(ctx, "interop", secret); err != nil {
+			t.Errorf("releasing through pg: %s", err)
+		}
+	})
+}
+
+func withPool(ctx context.Context, t *testing.T, f func(*pgxpool.Pool, string)) {
+	var (
+		dbhost   = os.Getenv("POSTGRES_HOST")
+		dbport   = os.Getenv("POSTGRES_PORT")
+		dbname   = os.Getenv("POSTGRES_DB")
+		dbuser   = os.Getenv("POSTGRES_USER")
+		dbpasswd = os.Getenv("POSTGRES_PASSWORD")
+	)
+
+	if dbuser == "" {
+		t.Skip("POSTGRES_USER must be set")
+	}
+
+	if dbhost == "" {
+		dbhost = "localhost"
+	}
+	if dbport == "" {
+		dbport = "5432"
+	}
+	if dbname == "" {
+		dbname = dbuser
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbhost, dbport, dbuser, dbpasswd, dbname)
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	f(pool, dsn)
+}
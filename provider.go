@@ -12,23 +12,37 @@ import (
 type Provider interface {
 	Clock
 
-	// Acquire acquires a lease if available and returns a secret, needed for Renew and Release.
+	// Acquire acquires a lease if available and returns a secret, needed for Renew and Release,
+	// and the lease's expiration time.
 	// The lease expires at the given time,
-	// or at the deadline of the provided context (if it has one), whichever is earlier.
+	// or at the deadline of the provided context (if it has one), whichever is earlier;
+	// or earlier still if the provider limits it further or stores it with less precision.
+	// The returned expiration time is the one the provider actually stored.
 	// Acquire does not wait; if the lease is already held by another caller, it returns [ErrHeld].
-	Acquire(context.Context, string, time.Time) (string, error)
+	Acquire(ctx context.Context, name string, exp time.Time) (secret string, effectiveExp time.Time, err error)
 
 	// Renew extends the lease for the given name, using the provided secret.
 	// Its expiration time is reset to the given time
-	// or the deadline of the provided context (if it has one), whichever is earlier.
+	// or the deadline of the provided context (if it has one), whichever is earlier
+	// (subject to the same provider limits as in Acquire),
+	// and the expiration time actually stored is returned.
 	// If the lease is not held by the caller, it returns [ErrNotHeld].
-	Renew(ctx context.Context, name, secret string, exp time.Time) error
+	Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error)
 
 	// Release releases the lease for the given name, using the provided secret.
 	// If the lease is not held by the caller, it returns [ErrNotHeld].
 	Release(ctx context.Context, name, secret string) error
 }
 
+// Waiter is implemented by a [Provider] that can wait for a held lease to become available.
+type Waiter interface {
+	// AcquireWait is like [Provider.Acquire],
+	// but if the lease is already held by another caller,
+	// it waits until the lease is released or expires and tries again,
+	// until it succeeds or the context is canceled.
+	AcquireWait(ctx context.Context, name string, exp time.Time) (secret string, effectiveExp time.Time, err error)
+}
+
 var (
 	// ErrHeld is the error returned by [Provider.Acquire] when the lease is already held by another caller.
 	ErrHeld = errors.New("lease already held by another caller")
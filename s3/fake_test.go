@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// fakeServer is a minimal stand-in for an S3-compatible object store
+// such as MinIO.
+// It supports path-style GET, PUT, and DELETE of objects
+// with the If-Match and If-None-Match conditions that [Provider] needs.
+type fakeServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte // keyed by "bucket/key"
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{objects: make(map[string][]byte)}
+}
+
+func etag(body []byte) string {
+	sum := md5.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, exists := s.objects[path]
+
+	// checkIfMatch reports whether the request may proceed,
+	// writing an error response if not.
+	checkIfMatch := func() bool {
+		ifMatch := req.Header.Get("If-Match")
+		if ifMatch == "" {
+			return true
+		}
+		if !exists {
+			s.error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return false
+		}
+		if ifMatch != etag(obj) {
+			s.error(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return false
+		}
+		return true
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if !exists {
+			s.error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("ETag", etag(obj))
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj)))
+		w.Write(obj)
+
+	case http.MethodPut:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			s.error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if req.Header.Get("If-None-Match") == "*" && exists {
+			s.error(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+		if !checkIfMatch() {
+			return
+		}
+		s.objects[path] = body
+		w.Header().Set("ETag", etag(body))
+
+	case http.MethodDelete:
+		if !checkIfMatch() {
+			return
+		}
+		delete(s.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	}
+}
+
+func (s *fakeServer) error(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, msg)
+}
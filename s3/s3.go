@@ -0,0 +1,254 @@
+// Package s3 implements [lease.Provider] in terms of objects in an S3-compatible object store
+// that supports conditional writes.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Client is the subset of the S3 API used by [Provider].
+// It is satisfied by [*awss3.Client].
+type Client interface {
+	GetObject(context.Context, *awss3.GetObjectInput, ...func(*awss3.Options)) (*awss3.GetObjectOutput, error)
+	PutObject(context.Context, *awss3.PutObjectInput, ...func(*awss3.Options)) (*awss3.PutObjectOutput, error)
+	DeleteObject(context.Context, *awss3.DeleteObjectInput, ...func(*awss3.Options)) (*awss3.DeleteObjectOutput, error)
+}
+
+// Provider is a lease.Provider implemented in terms of objects in an S3 bucket.
+//
+// Each lease is an object whose body holds the lease's secret and expiration time.
+// Creating a lease is a PUT conditional on the object not existing (If-None-Match: *),
+// and taking over, renewing, or releasing one is a PUT or DELETE
+// conditional on the object being unchanged since it was read (If-Match with its ETag).
+// The object store must support these conditions,
+// as Amazon S3 and MinIO do.
+//
+// Expiration is decided by the provider's clock (see [WithClock]).
+type Provider struct {
+	lease.Clock
+
+	client Client
+	bucket string
+	prefix string
+}
+
+var _ lease.Provider = &Provider{}
+
+// New creates a new object-store lease provider using the given client and bucket.
+func New(client Client, bucket string, opts ...Option) *Provider {
+	p := &Provider{
+		Clock:  lease.DefaultClock{},
+		client: client,
+		bucket: bucket,
+		prefix: DefaultPrefix,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// DefaultPrefix is the object-key prefix for leases
+// unless overridden with [WithPrefix].
+const DefaultPrefix = "leases/"
+
+// WithPrefix is an [Option] that sets the prefix of the object keys in which leases are stored.
+// The key for a lease is the prefix followed by the lease name.
+func WithPrefix(prefix string) Option {
+	return func(p *Provider) {
+		p.prefix = prefix
+	}
+}
+
+// record is the JSON-encoded body of a lease object.
+type record struct {
+	Secret string    `json:"secret"`
+	Exp    time.Time `json:"exp"`
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	rec, etag, err := p.get(ctx, name)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if etag != "" && rec.Exp.After(p.Now()) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	secret := hex.EncodeToString(secretBytes[:])
+
+	err = p.put(ctx, name, record{Secret: secret, Exp: exp}, etag)
+	if isPreconditionFailed(err) {
+		return "", time.Time{}, lease.ErrHeld
+	}
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+
+	return secret, exp, nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	rec, etag, err := p.get(ctx, name)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if etag == "" || rec.Secret != secret || !rec.Exp.After(p.Now()) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	rec.Exp = exp
+
+	err = p.put(ctx, name, rec, etag)
+	if isPreconditionFailed(err) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return exp, nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	rec, etag, err := p.get(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "getting lease %s", name)
+	}
+	if etag == "" || rec.Secret != secret {
+		return lease.ErrNotHeld
+	}
+
+	_, err = p.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket:  &p.bucket,
+		Key:     aws.String(p.prefix + name),
+		IfMatch: &etag,
+	})
+	if isPreconditionFailed(err) {
+		return lease.ErrNotHeld
+	}
+	return errors.Wrapf(err, "releasing lease %s", name)
+}
+
+// get reads the object for the given lease name,
+// returning its decoded body and its ETag.
+// The ETag is empty if the object does not exist.
+func (p *Provider) get(ctx context.Context, name string) (record, string, error) {
+	var rec record
+
+	out, err := p.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: &p.bucket,
+		Key:    aws.String(p.prefix + name),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return rec, "", nil
+	}
+	if err != nil {
+		return rec, "", err
+	}
+	defer out.Body.Close()
+
+	body, err := io.ReadAll(out.Body)
+	if err != nil {
+		return rec, "", errors.Wrap(err, "reading object")
+	}
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return rec, "", errors.Wrap(err, "decoding object")
+	}
+	if out.ETag == nil || *out.ETag == "" {
+		return rec, "", errors.New("object has no ETag")
+	}
+
+	return rec, *out.ETag, nil
+}
+
+// put writes the object for the given lease name.
+// If etag is empty, the write succeeds only if the object does not exist;
+// otherwise only if the object's ETag still matches.
+func (p *Provider) put(ctx context.Context, name string, rec record, etag string) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encoding object")
+	}
+
+	input := &awss3.PutObjectInput{
+		Bucket:      &p.bucket,
+		Key:         aws.String(p.prefix + name),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	}
+	if etag == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = &etag
+	}
+
+	_, err = p.client.PutObject(ctx, input)
+	return err
+}
+
+// isPreconditionFailed tells whether err reports a failed conditional write:
+// the condition did not hold (412 Precondition Failed),
+// a concurrent conditional write won (409 Conflict),
+// or the object to be replaced or deleted is gone (404 Not Found).
+func isPreconditionFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusPreconditionFailed, http.StatusConflict, http.StatusNotFound:
+			return true
+		}
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict", "NoSuchKey":
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(client Client, bucket string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		// A fresh prefix keeps runs against a shared bucket from interfering.
+		prefix := fmt.Sprintf("leases-test-%d/", time.Now().UnixNano())
+		return New(client, bucket, WithPrefix(prefix), WithClock(clock)), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	withBucket(t, func(client Client, bucket string) {
+		testutil.Provider(context.Background(), t, factory(client, bucket))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	withBucket(t, func(client Client, bucket string) {
+		testutil.Leader(context.Background(), t, factory(client, bucket))
+	})
+}
+
+// withBucket calls f with a client and bucket name.
+// If S3_ENDPOINT and S3_BUCKET are set,
+// the client talks to that S3-compatible endpoint,
+// using the credentials in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+// Otherwise it talks to an in-process [fakeServer].
+func withBucket(t *testing.T, f func(Client, string)) {
+	var (
+		endpoint = os.Getenv("S3_ENDPOINT")
+		bucket   = os.Getenv("S3_BUCKET")
+		creds    = credentials.NewStaticCredentialsProvider(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), "")
+	)
+	if endpoint == "" || bucket == "" {
+		srv := httptest.NewServer(newFakeServer())
+		defer srv.Close()
+
+		endpoint, bucket = srv.URL, "test"
+		creds = credentials.NewStaticCredentialsProvider("test", "test", "")
+	}
+
+	client := awss3.New(awss3.Options{
+		Region:                     "us-east-1",
+		Credentials:                creds,
+		BaseEndpoint:               aws.String(endpoint),
+		UsePathStyle:               true,
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+
+	f(client, bucket)
+}
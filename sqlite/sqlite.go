@@ -0,0 +1,300 @@
+// Package sqlite implements [lease.Provider] in terms of a SQLite database.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/bobg/errors"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/internal/gc"
+	"github.com/bobg/lease/v2/internal/secrets"
+)
+
+// Provider is a lease.Provider implemented in terms of a SQLite database.
+//
+// SQLite is an embedded database,
+// so the provider can coordinate only processes that share the database file,
+// normally processes on one host.
+// Expiration times are therefore measured by the provider's own clock,
+// with no need to defer to a database server's.
+//
+// Concurrent writers to a SQLite database
+// fail with SQLITE_BUSY unless the database handle waits for the write lock.
+// Open it with a busy timeout,
+// e.g. with the DSN "file:leases.db?_pragma=busy_timeout(5000)"
+// for the modernc.org/sqlite driver.
+type Provider struct {
+	lease.Clock
+
+	table string // name of the table that stores leases
+	db    *sql.DB
+
+	gcConfig  gc.Config
+	collector gc.Collector // runs GC in the background
+}
+
+var (
+	_ lease.Provider  = &Provider{}
+	_ lease.Inspector = &Provider{}
+	_ lease.Breaker   = &Provider{}
+)
+
+// New creates a new SQLite lease provider.
+// Leases are stored in a table with the given name.
+// The table is created if it does not already exist.
+func New(ctx context.Context, db *sql.DB, table string, opts ...Option) (*Provider, error) {
+	const qfmt = `CREATE TABLE IF NOT EXISTS %s (
+		name TEXT NOT NULL PRIMARY KEY,
+		secret TEXT NOT NULL,
+		exp_nanos INTEGER NOT NULL
+	)`
+	q := fmt.Sprintf(qfmt, table)
+
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return nil, errors.Wrapf(err, "creating table %s", table)
+	}
+
+	p := &Provider{
+		Clock:    lease.DefaultClock{},
+		table:    table,
+		db:       db,
+		gcConfig: gc.Config{Interval: DefaultGCInterval},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	// The caller's context governs only the construction of p.
+	// The garbage collector runs until Close is called.
+	p.collector.Start(ctx, p.Clock, p.gcConfig, p.GC)
+
+	return p, nil
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// DefaultGCInterval is how often a [Provider] deletes expired leases
+// unless overridden with [WithGCInterval].
+const DefaultGCInterval = gc.DefaultInterval
+
+// WithGCInterval is an [Option] that sets how often the provider deletes expired leases from its table.
+// A value of zero or less disables the background garbage collector;
+// expired leases can still be deleted on demand with [Provider.GC].
+func WithGCInterval(d time.Duration) Option {
+	return func(p *Provider) {
+		p.gcConfig.Interval = d
+	}
+}
+
+// WithGCBatchSize is an [Option] that limits how many expired leases a single DELETE statement removes.
+// Garbage collection issues as many statements as needed.
+// A value of zero or less (the default) means no limit.
+func WithGCBatchSize(n int) Option {
+	return func(p *Provider) {
+		p.gcConfig.Batch = n
+	}
+}
+
+// WithGCHook is an [Option] that sets a function to call after each run of the background garbage collector
+// with the number of expired leases deleted and the error, if any.
+func WithGCHook(f func(deleted int64, err error)) Option {
+	return func(p *Provider) {
+		p.gcConfig.Hook = f
+	}
+}
+
+// Close stops the background garbage collector (if any) and waits for it to exit.
+// It does _not_ close the underlying database connection.
+func (p *Provider) Close() {
+	p.collector.Stop()
+}
+
+// GC deletes expired leases from the provider's table,
+// returning the number deleted.
+// It is called periodically in the background unless disabled with [WithGCInterval],
+// but may also be called directly.
+func (p *Provider) GC(ctx context.Context) (int64, error) {
+	var total int64
+
+	for {
+		var (
+			q     string
+			qargs = []any{p.Now().UnixNano()}
+		)
+		if p.gcConfig.Batch > 0 {
+			// SQLite supports DELETE ... LIMIT only when compiled with an option that is off by default.
+			const qfmt = `DELETE FROM %[1]s WHERE name IN (SELECT name FROM %[1]s WHERE exp_nanos < ? LIMIT ?)`
+			q = fmt.Sprintf(qfmt, p.table)
+			qargs = append(qargs, p.gcConfig.Batch)
+		} else {
+			const qfmt = `DELETE FROM %s WHERE exp_nanos < ?`
+			q = fmt.Sprintf(qfmt, p.table)
+		}
+
+		res, err := p.db.ExecContext(ctx, q, qargs...)
+		if err != nil {
+			return total, errors.Wrap(err, "deleting expired leases")
+		}
+		aff, err := res.RowsAffected()
+		if err != nil {
+			return total, errors.Wrap(err, "counting affected rows")
+		}
+		total += aff
+
+		if p.gcConfig.Batch <= 0 || aff < int64(p.gcConfig.Batch) {
+			return total, nil
+		}
+	}
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	secret, err := secrets.New()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// The upsert changes no row if the lease is held.
+	const qfmt = `
+		INSERT INTO %s (name, secret, exp_nanos) VALUES (?, ?, ?)
+			ON CONFLICT (name) DO UPDATE
+				SET secret = excluded.secret, exp_nanos = excluded.exp_nanos
+				WHERE exp_nanos < ?`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	res, err := p.db.ExecContext(ctx, q, name, secret, exp.UnixNano(), p.Now().UnixNano())
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return "", time.Time{}, lease.ErrHeld
+	}
+
+	return secret, time.Unix(0, exp.UnixNano()), nil
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	const qfmt = `UPDATE %s SET exp_nanos = ? WHERE name = ? AND secret = ? AND exp_nanos > ?`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	res, err := p.db.ExecContext(ctx, q, exp.UnixNano(), name, secret, p.Now().UnixNano())
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	return time.Unix(0, exp.UnixNano()), nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	const qfmt = `DELETE FROM %s WHERE name = ? AND secret = ?`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	res, err := p.db.ExecContext(ctx, q, name, secret)
+	if err != nil {
+		return errors.Wrapf(err, "releasing lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return lease.ErrNotHeld
+	}
+
+	return nil
+}
+
+// Break implements [lease.Breaker].
+func (p *Provider) Break(ctx context.Context, name, _ string) error {
+	const qfmt = `DELETE FROM %s WHERE name = ? AND exp_nanos > ?`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	res, err := p.db.ExecContext(ctx, q, name, p.Now().UnixNano())
+	if err != nil {
+		return errors.Wrapf(err, "breaking lease %s", name)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting affected rows")
+	}
+	if aff == 0 {
+		return lease.ErrNotHeld
+	}
+
+	return nil
+}
+
+// Inspect implements [lease.Inspector].
+func (p *Provider) Inspect(ctx context.Context, name string) (lease.Info, bool, error) {
+	const qfmt = `SELECT exp_nanos FROM %s WHERE name = ? AND exp_nanos > ?`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	var expNanos int64
+	err := p.db.QueryRowContext(ctx, q, name, p.Now().UnixNano()).Scan(&expNanos)
+	if errors.Is(err, sql.ErrNoRows) {
+		return lease.Info{}, false, nil
+	}
+	if err != nil {
+		return lease.Info{}, false, errors.Wrapf(err, "inspecting lease %s", name)
+	}
+	return lease.Info{Name: name, Exp: time.Unix(0, expNanos)}, true, nil
+}
+
+// List implements [lease.Inspector].
+func (p *Provider) List(ctx context.Context, prefix string) ([]lease.Info, error) {
+	// SQLite compares TEXT bytewise by default,
+	// and substr counts characters, as does length.
+	const qfmt = `SELECT name, exp_nanos FROM %s WHERE substr(name, 1, length(?1)) = ?1 AND exp_nanos > ?2 ORDER BY name`
+	q := fmt.Sprintf(qfmt, p.table)
+
+	rows, err := p.db.QueryContext(ctx, q, prefix, p.Now().UnixNano())
+	if err != nil {
+		return nil, errors.Wrap(err, "listing leases")
+	}
+	defer rows.Close()
+
+	var result []lease.Info
+	for rows.Next() {
+		var (
+			name     string
+			expNanos int64
+		)
+		if err := rows.Scan(&name, &expNanos); err != nil {
+			return nil, errors.Wrap(err, "scanning lease row")
+		}
+		result = append(result, lease.Info{Name: name, Exp: time.Unix(0, expNanos)})
+	}
+
+	return result, errors.Wrap(rows.Err(), "iterating over lease rows")
+}
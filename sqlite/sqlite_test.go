@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	_ "modernc.org/sqlite"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(ctx context.Context, db *sql.DB) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(ctx, db, "leases", WithClock(clock))
+	}
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+	testutil.Provider(ctx, t, factory(ctx, openDB(t)))
+}
+
+func TestLeader(t *testing.T) {
+	ctx := context.Background()
+	testutil.Leader(ctx, t, factory(ctx, openDB(t)))
+}
+
+func TestInspector(t *testing.T) {
+	ctx := context.Background()
+	testutil.Inspector(ctx, t, factory(ctx, openDB(t)))
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	testutil.Breaker(ctx, t, factory(ctx, openDB(t)))
+}
+
+func TestShared(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = openDB(t)
+		exp = time.Now().Add(time.Minute)
+	)
+
+	p1, err := New(ctx, db, "leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p1.Close()
+
+	p2, err := New(ctx, db, "leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+
+	secret, _, err := p1.Acquire(ctx, "x", exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p2.Acquire(ctx, "x", exp); !errors.Is(err, lease.ErrHeld) {
+		t.Errorf("got error %v, want ErrHeld", err)
+	}
+	if _, err := p2.Renew(ctx, "x", secret, exp); err != nil {
+		t.Errorf("renewing with the same expiration time: %s", err)
+	}
+	if err := p2.Release(ctx, "x", secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := p2.Acquire(ctx, "x", exp); err != nil {
+		t.Errorf("acquiring released lease: %s", err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	p, err := New(ctx, openDB(t), "leases", WithClock(mockClock), WithGCInterval(0), WithGCBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 5; i++ {
+		exp := t0.Add(10 * time.Second)
+		if i%2 == 0 {
+			exp = t0.Add(30 * time.Second)
+		}
+		if _, _, err := p.Acquire(ctx, fmt.Sprintf("gc%d", i), exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mockClock.Add(20 * time.Second)
+
+	n, err := p.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d deleted after first expiry, want 2", n)
+	}
+
+	mockClock.Add(20 * time.Second)
+
+	n, err = p.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d deleted after second expiry, want 3", n)
+	}
+}
+
+func openDB(t *testing.T) *sql.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "leases.db") + "?_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,148 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Breaker tests a [lease.Provider] implementation that is also a [lease.Breaker].
+// The factory must produce a provider with no leases.
+// If the provider is a [lease.Historian] that records events,
+// the recorded break event is checked too.
+func Breaker(ctx context.Context, tb testing.TB, factory Factory) {
+	var (
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	provider, err := factory(mockClock)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	breaker, ok := provider.(lease.Breaker)
+	if !ok {
+		tb.Fatalf("provider of type %T is not a lease.Breaker", provider)
+	}
+
+	if err := breaker.Break(ctx, "break-test", "nothing to break"); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Fatalf("breaking unheld lease: got error %v, want ErrNotHeld", err)
+	}
+
+	secret, _, err := provider.Acquire(ctx, "break-test", t0.Add(10*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := breaker.Break(lease.WithHolder(ctx, "operator"), "break-test", "wedged"); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := provider.Renew(ctx, "break-test", secret, t0.Add(20*time.Second)); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("renewing broken lease: got error %v, want ErrNotHeld", err)
+	}
+	if err := provider.Release(ctx, "break-test", secret); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("releasing broken lease: got error %v, want ErrNotHeld", err)
+	}
+	if err := breaker.Break(ctx, "break-test", "again"); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("breaking broken lease: got error %v, want ErrNotHeld", err)
+	}
+
+	// The lease is available again.
+	secret, _, err = provider.Acquire(ctx, "break-test", t0.Add(10*time.Second))
+	if err != nil {
+		tb.Fatalf("acquiring broken lease: %v", err)
+	}
+	if err := provider.Release(ctx, "break-test", secret); err != nil {
+		tb.Fatal(err)
+	}
+
+	// Expired leases are not held, so cannot be broken.
+	if _, _, err := provider.Acquire(ctx, "break-test", t0.Add(10*time.Second)); err != nil {
+		tb.Fatal(err)
+	}
+	mockClock.Add(11 * time.Second) // t0+11s
+	if err := breaker.Break(ctx, "break-test", "expired"); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("breaking expired lease: got error %v, want ErrNotHeld", err)
+	}
+
+	if h, ok := provider.(lease.Historian); ok {
+		events, err := h.History(ctx, lease.HistoryQuery{Name: "break-test"})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if len(events) > 0 {
+			var found bool
+			for _, ev := range events {
+				if ev.Type != lease.EventBreak {
+					continue
+				}
+				if found {
+					tb.Errorf("extra break event %+v", ev)
+				}
+				found = true
+				if ev.Reason != "wedged" || ev.Holder != "operator" || !ev.Time.Equal(t0) {
+					tb.Errorf("got break event %+v, want reason wedged, holder operator, time %s", ev, t0)
+				}
+			}
+			if !found {
+				tb.Errorf("no break event in %+v", events)
+			}
+		}
+	}
+
+	// Breaking a lease cancels the Leader.Run callback holding it
+	// at its next renewal.
+	leader := lease.Leader{
+		Name:  "break-test-leader",
+		Dur:   10 * time.Second,
+		Retry: 10 * time.Second,
+		Renew: 5 * time.Second,
+	}
+
+	var (
+		running = make(chan struct{})
+		done    = make(chan error)
+	)
+	go func() {
+		_, err := leader.Run(ctx, provider, func(ctx context.Context) error {
+			close(running)
+			<-ctx.Done()
+			return context.Cause(ctx)
+		})
+		done <- err
+	}()
+
+	select {
+	case <-running:
+	case <-time.After(10 * time.Second):
+		tb.Fatal("leader callback did not start")
+	}
+
+	if err := breaker.Break(ctx, "break-test-leader", "test"); err != nil {
+		tb.Fatal(err)
+	}
+
+	// The leader may not have set its renewal timer yet,
+	// so keep advancing the clock until the renewal happens.
+	timeout := time.After(10 * time.Second)
+	for {
+		mockClock.Add(time.Second)
+
+		select {
+		case err := <-done:
+			if !errors.As(err, new(lease.RenewError)) || !errors.Is(err, lease.ErrNotHeld) {
+				tb.Errorf("leader callback got error %v, want a RenewError wrapping ErrNotHeld", err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			tb.Fatal("leader callback was not canceled")
+		}
+	}
+}
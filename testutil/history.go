@@ -0,0 +1,112 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/bobg/lease/v2"
+)
+
+// History tests the audit trail of a [lease.Provider] implementation that is also a [lease.Historian].
+// The factory must produce a provider with an empty history
+// and room for at least ten events.
+func History(ctx context.Context, tb testing.TB, factory Factory) {
+	var (
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	provider, err := factory(mockClock)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	historian, ok := provider.(lease.Historian)
+	if !ok {
+		tb.Fatalf("provider of type %T is not a lease.Historian", provider)
+	}
+
+	var (
+		alice = lease.WithHolder(ctx, "alice")
+		bob   = lease.WithHolder(ctx, "bob")
+	)
+
+	secret, _, err := provider.Acquire(alice, "h", t0.Add(10*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	mockClock.Add(5 * time.Second) // i.e. t0+5s
+
+	if _, err := provider.Renew(alice, "h", secret, t0.Add(20*time.Second)); err != nil {
+		tb.Fatal(err)
+	}
+
+	secret2, _, err := provider.Acquire(bob, "other", t0.Add(10*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	mockClock.Add(time.Second) // i.e. t0+6s
+
+	if err := provider.Release(bob, "other", secret2); err != nil {
+		tb.Fatal(err)
+	}
+
+	mockClock.Add(24 * time.Second) // i.e. t0+30s
+
+	secret3, _, err := provider.Acquire(bob, "h", t0.Add(40*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	mockClock.Add(time.Second) // i.e. t0+31s
+
+	if err := provider.Release(bob, "h", secret3); err != nil {
+		tb.Fatal(err)
+	}
+
+	// Failed calls are not recorded.
+	if err := provider.Release(alice, "h", secret); err == nil {
+		tb.Fatal("released lease with stale secret")
+	}
+
+	got, err := historian.History(ctx, lease.HistoryQuery{Name: "h"})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	checkEvents(tb, got, []lease.Event{
+		{Name: "h", Type: lease.EventAcquire, Holder: "alice", Time: t0, Exp: t0.Add(10 * time.Second)},
+		{Name: "h", Type: lease.EventRenew, Holder: "alice", Time: t0.Add(5 * time.Second), Exp: t0.Add(20 * time.Second)},
+		{Name: "h", Type: lease.EventTakeover, Holder: "bob", Time: t0.Add(30 * time.Second), Exp: t0.Add(40 * time.Second)},
+		{Name: "h", Type: lease.EventRelease, Holder: "bob", Time: t0.Add(31 * time.Second)},
+	})
+
+	got, err = historian.History(ctx, lease.HistoryQuery{Since: t0.Add(5 * time.Second), Until: t0.Add(30 * time.Second)})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	checkEvents(tb, got, []lease.Event{
+		{Name: "h", Type: lease.EventRenew, Holder: "alice", Time: t0.Add(5 * time.Second), Exp: t0.Add(20 * time.Second)},
+		{Name: "other", Type: lease.EventAcquire, Holder: "bob", Time: t0.Add(5 * time.Second), Exp: t0.Add(10 * time.Second)},
+		{Name: "other", Type: lease.EventRelease, Holder: "bob", Time: t0.Add(6 * time.Second)},
+	})
+}
+
+func checkEvents(tb testing.TB, got, want []lease.Event) {
+	tb.Helper()
+
+	if len(got) != len(want) {
+		tb.Fatalf("got %d events %v, want %d", len(got), got, len(want))
+	}
+	for i, g := range got {
+		w := want[i]
+		if g.Name != w.Name || g.Type != w.Type || g.Holder != w.Holder || !g.Time.Equal(w.Time) || !g.Exp.Equal(w.Exp) {
+			tb.Errorf("event %d: got %+v, want %+v", i, g, w)
+		}
+	}
+}
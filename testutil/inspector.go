@@ -0,0 +1,105 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Inspector tests a [lease.Provider] implementation that is also a [lease.Inspector].
+// The factory must produce a provider with no leases.
+func Inspector(ctx context.Context, tb testing.TB, factory Factory) {
+	var (
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	provider, err := factory(mockClock)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	inspector, ok := provider.(lease.Inspector)
+	if !ok {
+		tb.Fatalf("provider of type %T is not a lease.Inspector", provider)
+	}
+
+	checkInspect := func(name string, wantOK bool, wantExp time.Time) {
+		tb.Helper()
+
+		info, ok, err := inspector.Inspect(ctx, name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if ok != wantOK {
+			tb.Fatalf("inspecting %s: got ok %v, want %v", name, ok, wantOK)
+		}
+		if ok && (info.Name != name || !info.Exp.Equal(wantExp)) {
+			tb.Errorf("inspecting %s: got %+v, want exp %s", name, info, wantExp)
+		}
+	}
+
+	checkList := func(prefix string, want ...lease.Info) {
+		tb.Helper()
+
+		got, err := inspector.List(ctx, prefix)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if len(got) != len(want) {
+			tb.Fatalf("listing %q: got %v, want %v", prefix, got, want)
+		}
+		for i, g := range got {
+			if g.Name != want[i].Name || !g.Exp.Equal(want[i].Exp) {
+				tb.Errorf("listing %q: item %d is %+v, want %+v", prefix, i, g, want[i])
+			}
+		}
+	}
+
+	checkInspect("a/x", false, time.Time{})
+	checkList("")
+
+	secret, _, err := provider.Acquire(ctx, "a/x", t0.Add(10*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, _, err := provider.Acquire(ctx, "b/y", t0.Add(20*time.Second)); err != nil {
+		tb.Fatal(err)
+	}
+	if _, _, err := provider.Acquire(ctx, "a/z", t0.Add(30*time.Second)); err != nil {
+		tb.Fatal(err)
+	}
+
+	checkInspect("a/x", true, t0.Add(10*time.Second))
+	checkList("",
+		lease.Info{Name: "a/x", Exp: t0.Add(10 * time.Second)},
+		lease.Info{Name: "a/z", Exp: t0.Add(30 * time.Second)},
+		lease.Info{Name: "b/y", Exp: t0.Add(20 * time.Second)},
+	)
+	checkList("a/",
+		lease.Info{Name: "a/x", Exp: t0.Add(10 * time.Second)},
+		lease.Info{Name: "a/z", Exp: t0.Add(30 * time.Second)},
+	)
+
+	// Prefixes are not patterns.
+	checkList("a%")
+	checkList("a_")
+
+	if err := provider.Release(ctx, "a/x", secret); err != nil {
+		tb.Fatal(err)
+	}
+	checkInspect("a/x", false, time.Time{})
+
+	mockClock.Add(25 * time.Second) // i.e. t0+25s
+
+	// Expired leases are not reported.
+	checkInspect("b/y", false, time.Time{})
+	checkList("",
+		lease.Info{Name: "a/z", Exp: t0.Add(30 * time.Second)},
+	)
+}
@@ -9,7 +9,7 @@ import (
 
 	"github.com/benbjohnson/clock"
 
-	"github.com/bobg/lease"
+	"github.com/bobg/lease/v2"
 )
 
 // Leader tests the ability of a [lease.Provider] implementation to support the [lease.Leader] behavior.
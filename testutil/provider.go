@@ -8,7 +8,7 @@ import (
 
 	"github.com/benbjohnson/clock"
 
-	"github.com/bobg/lease"
+	"github.com/bobg/lease/v2"
 )
 
 // Factory creates a [lease.Provider] using the given [lease.Clock].
@@ -27,18 +27,21 @@ func Provider(ctx context.Context, tb testing.TB, factory Factory) {
 		tb.Fatal(err)
 	}
 
-	secret, err := provider.Acquire(ctx, "test", t0.Add(10*time.Second))
+	secret, exp, err := provider.Acquire(ctx, "test", t0.Add(10*time.Second))
 	if err != nil {
 		tb.Fatalf("Error acquiring lease: %s", err)
 	}
 	defer provider.Release(ctx, "test", secret)
+	if want := t0.Add(10 * time.Second); !exp.Equal(want) {
+		tb.Errorf("got expiration time %s from Acquire, want %s", exp, want)
+	}
 
-	_, err = provider.Acquire(ctx, "test", t0.Add(10*time.Second))
+	_, _, err = provider.Acquire(ctx, "test", t0.Add(10*time.Second))
 	if !errors.Is(err, lease.ErrHeld) {
 		tb.Errorf("got error %v, want ErrHeld", err)
 	}
 
-	secret2, err := provider.Acquire(ctx, "test2", t0.Add(20*time.Second))
+	secret2, _, err := provider.Acquire(ctx, "test2", t0.Add(20*time.Second))
 	if err != nil {
 		tb.Fatal(err)
 	}
@@ -46,26 +49,26 @@ func Provider(ctx context.Context, tb testing.TB, factory Factory) {
 
 	mockClock.Add(5 * time.Second) // i.e. t0+5s
 
-	_, err = provider.Acquire(ctx, "test", t0.Add(10*time.Second))
+	_, _, err = provider.Acquire(ctx, "test", t0.Add(10*time.Second))
 	if !errors.Is(err, lease.ErrHeld) {
 		tb.Errorf("got error %v, want ErrHeld", err)
 	}
 
 	mockClock.Add(10 * time.Second) // i.e. t0+15s
 
-	secret3, err := provider.Acquire(ctx, "test", t0.Add(40*time.Second))
+	secret3, _, err := provider.Acquire(ctx, "test", t0.Add(40*time.Second))
 	if err != nil {
 		tb.Fatalf("Error acquiring expired lease: %s", err)
 	}
 	defer provider.Release(ctx, "test", secret3)
 
 	// Can no longer renew the lease with the old secret.
-	err = provider.Renew(ctx, "test", secret, t0.Add(20*time.Second))
+	_, err = provider.Renew(ctx, "test", secret, t0.Add(20*time.Second))
 	if !errors.Is(err, lease.ErrNotHeld) {
 		tb.Errorf("got error %v, want ErrNotHeld", err)
 	}
 
-	_, err = provider.Acquire(ctx, "test2", t0.Add(20*time.Second))
+	_, _, err = provider.Acquire(ctx, "test2", t0.Add(20*time.Second))
 	if !errors.Is(err, lease.ErrHeld) {
 		tb.Errorf("got error %v, want ErrHeld", err)
 	}
@@ -77,21 +80,24 @@ func Provider(ctx context.Context, tb testing.TB, factory Factory) {
 
 	mockClock.Add(20 * time.Second) // i.e. t0+35s
 
-	err = provider.Renew(ctx, "test", secret3, t0.Add(50*time.Second))
+	exp, err = provider.Renew(ctx, "test", secret3, t0.Add(50*time.Second))
 	if err != nil {
 		tb.Fatalf("Error renewing lease: %s", err)
 	}
+	if want := t0.Add(50 * time.Second); !exp.Equal(want) {
+		tb.Errorf("got expiration time %s from Renew, want %s", exp, want)
+	}
 
 	mockClock.Add(10 * time.Second) // i.e. t0+45s
 
-	_, err = provider.Acquire(ctx, "test", t0.Add(60*time.Second))
+	_, _, err = provider.Acquire(ctx, "test", t0.Add(60*time.Second))
 	if !errors.Is(err, lease.ErrHeld) {
 		tb.Errorf("got error %v, want ErrHeld", err)
 	}
 
 	mockClock.Add(10 * time.Second) // i.e. t0+65s
 
-	secret4, err := provider.Acquire(ctx, "test", t0.Add(80*time.Second))
+	secret4, _, err := provider.Acquire(ctx, "test", t0.Add(80*time.Second))
 	if err != nil {
 		tb.Fatalf("Error acquiring expired lease: %s", err)
 	}
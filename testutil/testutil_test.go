@@ -4,8 +4,8 @@ import (
 	"context"
 	"testing"
 
-	"github.com/bobg/lease"
-	"github.com/bobg/lease/mem"
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/mem"
 )
 
 // These tests already appear elsewhere in this library.
@@ -24,3 +24,39 @@ func TestLeader(t *testing.T) {
 func TestProvider(t *testing.T) {
 	Provider(context.Background(), t, factory)
 }
+
+func TestHistory(t *testing.T) {
+	History(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New(mem.WithHistory(10))
+		p.Clock = clock
+		return p, nil
+	})
+}
+
+func TestInspector(t *testing.T) {
+	Inspector(context.Background(), t, factory)
+}
+
+func TestBreaker(t *testing.T) {
+	Breaker(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New(mem.WithHistory(20))
+		p.Clock = clock
+		return p, nil
+	})
+}
+
+func TestTransferer(t *testing.T) {
+	Transferer(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New(mem.WithHistory(20))
+		p.Clock = clock
+		return p, nil
+	})
+}
+
+func TestTTLProvider(t *testing.T) {
+	TTLProvider(context.Background(), t, func(clock lease.Clock) (lease.Provider, error) {
+		p := mem.New()
+		p.Clock = clock
+		return p, nil
+	})
+}
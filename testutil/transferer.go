@@ -0,0 +1,124 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Transferer tests a [lease.Provider] implementation that is also a [lease.Transferer].
+// The factory must produce a provider with no leases.
+// If the provider is a [lease.Inspector] or a [lease.Historian] that records events,
+// the transferred lease's expiration time and the recorded transfer event are checked too.
+func Transferer(ctx context.Context, tb testing.TB, factory Factory) {
+	var (
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	provider, err := factory(mockClock)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	transferer, ok := provider.(lease.Transferer)
+	if !ok {
+		tb.Fatalf("provider of type %T is not a lease.Transferer", provider)
+	}
+
+	if _, _, err := transferer.Transfer(ctx, "transfer-test", "bogus", t0.Add(10*time.Second)); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Fatalf("transferring unheld lease: got error %v, want ErrNotHeld", err)
+	}
+
+	oldSecret, _, err := provider.Acquire(lease.WithHolder(ctx, "blue"), "transfer-test", t0.Add(10*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, _, err := transferer.Transfer(ctx, "transfer-test", "bogus", t0.Add(20*time.Second)); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("transferring lease with wrong secret: got error %v, want ErrNotHeld", err)
+	}
+
+	newSecret, _, err := transferer.Transfer(lease.WithHolder(ctx, "green"), "transfer-test", oldSecret, t0.Add(20*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if newSecret == "" || newSecret == oldSecret {
+		tb.Fatalf("got new secret %q, want a fresh one", newSecret)
+	}
+
+	// The lease is held throughout.
+	if _, _, err := provider.Acquire(ctx, "transfer-test", t0.Add(10*time.Second)); !errors.Is(err, lease.ErrHeld) {
+		tb.Errorf("acquiring transferred lease: got error %v, want ErrHeld", err)
+	}
+
+	// The old secret is no longer valid.
+	if _, err := provider.Renew(ctx, "transfer-test", oldSecret, t0.Add(30*time.Second)); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("renewing with old secret: got error %v, want ErrNotHeld", err)
+	}
+	if err := provider.Release(ctx, "transfer-test", oldSecret); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("releasing with old secret: got error %v, want ErrNotHeld", err)
+	}
+	if _, _, err := transferer.Transfer(ctx, "transfer-test", oldSecret, t0.Add(30*time.Second)); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("transferring with old secret: got error %v, want ErrNotHeld", err)
+	}
+
+	if insp, ok := provider.(lease.Inspector); ok {
+		info, ok, err := insp.Inspect(ctx, "transfer-test")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if !ok || !info.Exp.Equal(t0.Add(20*time.Second)) {
+			tb.Errorf("got info %+v (ok=%v) for transferred lease, want expiration time %s", info, ok, t0.Add(20*time.Second))
+		}
+	}
+
+	// The new expiration time is in effect.
+	mockClock.Add(15 * time.Second) // t0+15s
+	if _, err := provider.Renew(ctx, "transfer-test", newSecret, t0.Add(30*time.Second)); err != nil {
+		tb.Errorf("renewing transferred lease after its original expiration time: %v", err)
+	}
+	if err := provider.Release(ctx, "transfer-test", newSecret); err != nil {
+		tb.Fatal(err)
+	}
+
+	// Expired leases are not held, so cannot be transferred.
+	secret, _, err := provider.Acquire(ctx, "transfer-test", t0.Add(25*time.Second))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	mockClock.Add(11 * time.Second) // t0+26s
+	if _, _, err := transferer.Transfer(ctx, "transfer-test", secret, t0.Add(40*time.Second)); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("transferring expired lease: got error %v, want ErrNotHeld", err)
+	}
+
+	if h, ok := provider.(lease.Historian); ok {
+		events, err := h.History(ctx, lease.HistoryQuery{Name: "transfer-test"})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if len(events) > 0 {
+			var found bool
+			for _, ev := range events {
+				if ev.Type != lease.EventTransfer {
+					continue
+				}
+				if found {
+					tb.Errorf("extra transfer event %+v", ev)
+				}
+				found = true
+				if ev.Holder != "green" || !ev.Time.Equal(t0) || !ev.Exp.Equal(t0.Add(20*time.Second)) {
+					tb.Errorf("got transfer event %+v, want holder green, time %s, expiration time %s", ev, t0, t0.Add(20*time.Second))
+				}
+			}
+			if !found {
+				tb.Errorf("no transfer event in %+v", events)
+			}
+		}
+	}
+}
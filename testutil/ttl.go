@@ -0,0 +1,91 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/bobg/lease/v2"
+)
+
+// TTLProvider tests a [lease.Provider] implementation that is also a [lease.TTLProvider].
+// The factory must produce a provider with no leases,
+// whose clock is the one given.
+func TTLProvider(ctx context.Context, tb testing.TB, factory Factory) {
+	var (
+		mockClock = clock.NewMock()
+		t0        = time.Date(1977, 8, 5, 0, 0, 0, 0, time.UTC)
+	)
+	mockClock.Set(t0)
+
+	provider, err := factory(mockClock)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tp, ok := provider.(lease.TTLProvider)
+	if !ok {
+		tb.Fatalf("provider of type %T is not a lease.TTLProvider", provider)
+	}
+
+	secret, exp, err := tp.AcquireTTL(ctx, "ttl-test", 10*time.Second)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if want := t0.Add(10 * time.Second); !exp.Equal(want) {
+		tb.Errorf("got expiration time %s after acquiring, want %s", exp, want)
+	}
+
+	if _, _, err := tp.AcquireTTL(ctx, "ttl-test", 10*time.Second); !errors.Is(err, lease.ErrHeld) {
+		tb.Errorf("acquiring held lease: got error %v, want ErrHeld", err)
+	}
+
+	mockClock.Add(5 * time.Second) // t0+5s
+
+	exp, err = tp.RenewTTL(ctx, "ttl-test", secret, 10*time.Second)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if want := t0.Add(15 * time.Second); !exp.Equal(want) {
+		tb.Errorf("got expiration time %s after renewing, want %s", exp, want)
+	}
+	if _, err := tp.RenewTTL(ctx, "ttl-test", "bogus", 10*time.Second); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("renewing with wrong secret: got error %v, want ErrNotHeld", err)
+	}
+
+	if insp, ok := provider.(lease.Inspector); ok {
+		info, ok, err := insp.Inspect(ctx, "ttl-test")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if !ok || !info.Exp.Equal(exp) {
+			tb.Errorf("got info %+v (ok=%v), want expiration time %s", info, ok, exp)
+		}
+	}
+
+	mockClock.Add(11 * time.Second) // t0+16s
+
+	// The renewed lease has expired.
+	if _, err := tp.RenewTTL(ctx, "ttl-test", secret, 10*time.Second); !errors.Is(err, lease.ErrNotHeld) {
+		tb.Errorf("renewing expired lease: got error %v, want ErrNotHeld", err)
+	}
+
+	secret, exp, err = tp.AcquireTTL(ctx, "ttl-test", 10*time.Second)
+	if err != nil {
+		tb.Fatalf("acquiring expired lease: %v", err)
+	}
+	if want := t0.Add(26 * time.Second); !exp.Equal(want) {
+		tb.Errorf("got expiration time %s after reacquiring, want %s", exp, want)
+	}
+
+	// The TTL variants interoperate with the plain methods.
+	if _, err := provider.Renew(ctx, "ttl-test", secret, t0.Add(30*time.Second)); err != nil {
+		tb.Fatal(err)
+	}
+	if err := provider.Release(ctx, "ttl-test", secret); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -0,0 +1,25 @@
+package lease
+
+import (
+	"context"
+	"time"
+)
+
+// Transferer is implemented by a [Provider] that can hand a held lease to a new holder
+// with no interval in which the lease is unheld,
+// e.g. from the old process to the new one in a blue/green deploy.
+type Transferer interface {
+	// Transfer atomically replaces the secret of the lease with the given name,
+	// which must be held with the given secret,
+	// and sets its expiration time to exp
+	// (limited as in [Provider.Renew]),
+	// returning the new secret for the recipient to use
+	// and the expiration time actually stored.
+	// The old secret is no longer valid.
+	//
+	// The recipient's identity is the holder in ctx (see [WithHolder]).
+	// A [Historian] records it with an [EventTransfer] event.
+	//
+	// Transfer returns [ErrNotHeld] if the lease is not held with the given secret.
+	Transfer(ctx context.Context, name, secret string, exp time.Time) (newSecret string, effectiveExp time.Time, err error)
+}
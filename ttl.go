@@ -0,0 +1,24 @@
+package lease
+
+import (
+	"context"
+	"time"
+)
+
+// TTLProvider is implemented by a [Provider] that can compute expiration times itself,
+// from durations and its own authoritative clock,
+// rather than taking them from callers whose clocks may disagree.
+// [Leader] uses it when available.
+type TTLProvider interface {
+	// AcquireTTL is like [Provider.Acquire],
+	// but the lease expires after the given duration
+	// as measured by the provider,
+	// and the resulting expiration time is returned.
+	AcquireTTL(ctx context.Context, name string, ttl time.Duration) (secret string, exp time.Time, err error)
+
+	// RenewTTL is like [Provider.Renew],
+	// but the lease's expiration time is reset to the given duration from now
+	// as measured by the provider,
+	// and the resulting expiration time is returned.
+	RenewTTL(ctx context.Context, name, secret string, ttl time.Duration) (time.Time, error)
+}
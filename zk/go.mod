@@ -0,0 +1,16 @@
+module github.com/bobg/lease/v2/zk
+
+go 1.22.0
+
+require (
+	github.com/bobg/errors v1.1.0
+	github.com/bobg/lease/v2 v2.0.0
+	github.com/go-zookeeper/zk v1.0.4
+)
+
+require (
+	github.com/benbjohnson/clock v1.3.5 // indirect
+	github.com/bobg/retry v0.2.0 // indirect
+)
+
+replace github.com/bobg/lease/v2 => ../
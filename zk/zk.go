@@ -0,0 +1,372 @@
+// Package zk implements [lease.Provider] in terms of a ZooKeeper ensemble.
+package zk
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	gozk "github.com/go-zookeeper/zk"
+
+	"github.com/bobg/lease/v2"
+)
+
+// Provider is a lease.Provider implemented in terms of a ZooKeeper ensemble.
+//
+// Each lease is a directory znode
+// under which contenders create ephemeral sequential znodes,
+// as in ZooKeeper's lock recipe.
+// The contender whose znode has the lowest sequence number holds the lease.
+// Since the znodes are ephemeral,
+// the leases held through a connection are released when its session expires.
+//
+// A znode's sequence number doubles as a fencing token;
+// see [Provider.Fence].
+//
+// [Provider.Acquire] fails with [lease.ErrHeld] unless the lease is free,
+// but [Provider.AcquireWait] joins a fair queue of waiters,
+// which acquire the lease in the order they arrived.
+//
+// Expiration is decided according to the provider's clock (see [WithClock]).
+// A holder's znode is deleted by the next contender to find it expired.
+//
+// The ZooKeeper client does not accept contexts,
+// so context cancellation is honored only while waiting in [Provider.AcquireWait].
+type Provider struct {
+	lease.Clock
+
+	conn   *gozk.Conn
+	prefix string
+	acl    []gozk.ACL
+}
+
+var (
+	_ lease.Provider = &Provider{}
+	_ lease.Waiter   = &Provider{}
+)
+
+// New creates a new ZooKeeper lease provider using the given connection.
+func New(conn *gozk.Conn, opts ...Option) *Provider {
+	p := &Provider{
+		Clock:  lease.DefaultClock{},
+		conn:   conn,
+		prefix: DefaultPrefix,
+		acl:    gozk.WorldACL(gozk.PermAll),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Option is the type of an option that can be passed to [New].
+type Option func(*Provider)
+
+// WithClock is an [Option] that sets the clock used by the provider.
+func WithClock(c lease.Clock) Option {
+	return func(p *Provider) {
+		p.Clock = c
+	}
+}
+
+// DefaultPrefix is the path of the znode under which leases are stored
+// unless overridden with [WithPrefix].
+const DefaultPrefix = "/lease"
+
+// WithPrefix is an [Option] that sets the path of the znode under which leases are stored.
+// The directory znode for a lease is the prefix, a slash, and the lease name.
+func WithPrefix(prefix string) Option {
+	return func(p *Provider) {
+		p.prefix = prefix
+	}
+}
+
+// WithACL is an [Option] that sets the ACL of the znodes the provider creates.
+// The default is [gozk.WorldACL] with [gozk.PermAll].
+func WithACL(acl []gozk.ACL) Option {
+	return func(p *Provider) {
+		p.acl = acl
+	}
+}
+
+// nodePrefix is the name prefix of contenders' znodes,
+// to which ZooKeeper appends a sequence number.
+const nodePrefix = "lease-"
+
+// record is the JSON-encoded data of a contender's znode.
+type record struct {
+	Secret  string    `json:"secret"`
+	Exp     time.Time `json:"exp"`
+	Waiting bool      `json:"waiting,omitempty"` // queued in AcquireWait and not yet the holder
+}
+
+func (p *Provider) Acquire(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	return p.acquire(ctx, name, exp, false)
+}
+
+// AcquireWait is like [Provider.Acquire]
+// but if the lease is held by someone else,
+// it joins a queue of waiters
+// and waits for its turn,
+// until it succeeds or the context is canceled.
+//
+// Each waiter watches only the znode immediately ahead of its own,
+// and sets a timer for that contender's expiration time if it holds the lease,
+// so a release or expiry wakes only the next waiter.
+// Since the lease may be acquired long after AcquireWait is called,
+// callers typically choose exp relative to the time it returns
+// and renew the lease promptly.
+func (p *Provider) AcquireWait(ctx context.Context, name string, exp time.Time) (string, time.Time, error) {
+	return p.acquire(ctx, name, exp, true)
+}
+
+func (p *Provider) acquire(ctx context.Context, name string, exp time.Time, wait bool) (string, time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	dir := p.dir(name)
+	if err := p.ensureDir(dir); err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "creating %s", dir)
+	}
+
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generating secret")
+	}
+	rec := record{
+		Secret:  hex.EncodeToString(secretBytes[:]),
+		Exp:     exp,
+		Waiting: wait,
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "encoding lease")
+	}
+
+	nodePath, err := p.conn.Create(path.Join(dir, nodePrefix), data, gozk.FlagEphemeral|gozk.FlagSequence, p.acl)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "creating znode for lease %s", name)
+	}
+	node := path.Base(nodePath)
+
+	acquired := false
+	defer func() {
+		if !acquired {
+			_ = p.conn.Delete(nodePath, -1)
+		}
+	}()
+
+	for {
+		pred, err := p.predecessor(dir, node)
+		if err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "listing contenders for lease %s", name)
+		}
+
+		if pred == "" {
+			// This contender is first in line.
+			if wait {
+				rec.Waiting = false
+				data, err := json.Marshal(rec)
+				if err != nil {
+					return "", time.Time{}, errors.Wrap(err, "encoding lease")
+				}
+				if _, err := p.conn.Set(nodePath, data, -1); err != nil {
+					return "", time.Time{}, errors.Wrapf(err, "acquiring lease %s", name)
+				}
+			}
+			acquired = true
+			return node + ":" + rec.Secret, rec.Exp, nil
+		}
+
+		predPath := path.Join(dir, pred)
+
+		var (
+			predData []byte
+			stat     *gozk.Stat
+			watch    <-chan gozk.Event
+		)
+		if wait {
+			predData, stat, watch, err = p.conn.GetW(predPath)
+		} else {
+			predData, stat, err = p.conn.Get(predPath)
+		}
+		if errors.Is(err, gozk.ErrNoNode) {
+			continue
+		}
+		if err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "getting contender for lease %s", name)
+		}
+
+		var predRec record
+		if err := json.Unmarshal(predData, &predRec); err != nil {
+			return "", time.Time{}, errors.Wrapf(err, "decoding contender for lease %s", name)
+		}
+
+		if !predRec.Waiting && !predRec.Exp.After(p.Now()) {
+			// The contender ahead holds the lease but it has expired.
+			// Delete its znode, unless it has been renewed in the meantime.
+			err := p.conn.Delete(predPath, stat.Version)
+			if err != nil && !errors.Is(err, gozk.ErrNoNode) && !errors.Is(err, gozk.ErrBadVersion) {
+				return "", time.Time{}, errors.Wrapf(err, "deleting expired contender for lease %s", name)
+			}
+			continue
+		}
+
+		if !wait {
+			return "", time.Time{}, lease.ErrHeld
+		}
+
+		var timer <-chan time.Time
+		if !predRec.Waiting {
+			timer = p.After(predRec.Exp.Sub(p.Now()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", time.Time{}, ctx.Err()
+		case <-watch:
+		case <-timer:
+		}
+	}
+}
+
+func (p *Provider) Renew(ctx context.Context, name, secret string, exp time.Time) (time.Time, error) {
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(exp) {
+		exp = deadline
+	}
+
+	nodePath, rec, stat, err := p.get(name, secret)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !rec.Exp.After(p.Now()) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+
+	rec.Exp = exp
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "encoding lease")
+	}
+
+	_, err = p.conn.Set(nodePath, data, stat.Version)
+	if errors.Is(err, gozk.ErrNoNode) || errors.Is(err, gozk.ErrBadVersion) {
+		return time.Time{}, lease.ErrNotHeld
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "renewing lease %s", name)
+	}
+	return exp, nil
+}
+
+func (p *Provider) Release(ctx context.Context, name, secret string) error {
+	nodePath, _, stat, err := p.get(name, secret)
+	if err != nil {
+		return err
+	}
+
+	err = p.conn.Delete(nodePath, stat.Version)
+	if errors.Is(err, gozk.ErrNoNode) || errors.Is(err, gozk.ErrBadVersion) {
+		return lease.ErrNotHeld
+	}
+	return errors.Wrapf(err, "releasing lease %s", name)
+}
+
+// Fence returns the fencing token for a held lease:
+// the sequence number of the holder's znode.
+// Successive holders of a lease have increasing fencing tokens,
+// so a resource guarded by the lease can reject requests bearing a token lower than one it has already seen.
+// If the lease is not held with the given secret, Fence returns [lease.ErrNotHeld].
+func (p *Provider) Fence(ctx context.Context, name, secret string) (int64, error) {
+	nodePath, rec, _, err := p.get(name, secret)
+	if err != nil {
+		return 0, err
+	}
+	if !rec.Exp.After(p.Now()) {
+		return 0, lease.ErrNotHeld
+	}
+	return seq(path.Base(nodePath)), nil
+}
+
+// get returns the path, data, and stat of the znode of the holder of the named lease,
+// or [lease.ErrNotHeld] if the lease is not held with the given secret.
+func (p *Provider) get(name, secret string) (string, record, *gozk.Stat, error) {
+	var rec record
+
+	// The secret returned by acquire is the name of the holder's znode,
+	// a colon, and the random secret stored in the znode.
+	node, want, ok := strings.Cut(secret, ":")
+	if !ok || !strings.HasPrefix(node, nodePrefix) || strings.Contains(node, "/") {
+		return "", rec, nil, lease.ErrNotHeld
+	}
+	nodePath := path.Join(p.dir(name), node)
+
+	data, stat, err := p.conn.Get(nodePath)
+	if errors.Is(err, gozk.ErrNoNode) {
+		return "", rec, nil, lease.ErrNotHeld
+	}
+	if err != nil {
+		return "", rec, nil, errors.Wrapf(err, "getting lease %s", name)
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return "", rec, nil, errors.Wrapf(err, "decoding lease %s", name)
+	}
+	if rec.Secret != want || rec.Waiting {
+		return "", rec, nil, lease.ErrNotHeld
+	}
+
+	return nodePath, rec, stat, nil
+}
+
+// predecessor returns the name of the contender's znode immediately ahead of node in dir,
+// or the empty string if node is first in line.
+func (p *Provider) predecessor(dir, node string) (string, error) {
+	children, _, err := p.conn.Children(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		mine = seq(node)
+		pred string
+	)
+	for _, child := range children {
+		if !strings.HasPrefix(child, nodePrefix) {
+			continue
+		}
+		if s := seq(child); s < mine && (pred == "" || s > seq(pred)) {
+			pred = child
+		}
+	}
+	return pred, nil
+}
+
+// seq returns the sequence number that ZooKeeper appended to the name of a contender's znode.
+func seq(node string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimPrefix(node, nodePrefix), 10, 64)
+	return n
+}
+
+func (p *Provider) dir(name string) string {
+	return path.Join(p.prefix, name)
+}
+
+// ensureDir creates the znode at dir and its ancestors, as needed.
+func (p *Provider) ensureDir(dir string) error {
+	parts := strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	for i := range parts {
+		znode := "/" + strings.Join(parts[:i+1], "/")
+		_, err := p.conn.Create(znode, nil, 0, p.acl)
+		if err != nil && !errors.Is(err, gozk.ErrNodeExists) {
+			return err
+		}
+	}
+	return nil
+}
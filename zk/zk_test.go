@@ -0,0 +1,156 @@
+package zk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	gozk "github.com/go-zookeeper/zk"
+
+	"github.com/bobg/lease/v2"
+	"github.com/bobg/lease/v2/testutil"
+)
+
+func factory(conn *gozk.Conn, prefix string) func(lease.Clock) (lease.Provider, error) {
+	return func(clock lease.Clock) (lease.Provider, error) {
+		return New(conn, WithPrefix(prefix), WithClock(clock)), nil
+	}
+}
+
+func TestProvider(t *testing.T) {
+	withConn(t, func(conn *gozk.Conn, prefix string) {
+		testutil.Provider(context.Background(), t, factory(conn, prefix))
+	})
+}
+
+func TestLeader(t *testing.T) {
+	withConn(t, func(conn *gozk.Conn, prefix string) {
+		testutil.Leader(context.Background(), t, factory(conn, prefix))
+	})
+}
+
+func TestFence(t *testing.T) {
+	ctx := context.Background()
+
+	withConn(t, func(conn *gozk.Conn, prefix string) {
+		p := New(conn, WithPrefix(prefix))
+
+		secret, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fence1, err := p.Fence(ctx, "test", secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Release(ctx, "test", secret); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Fence(ctx, "test", secret); !errors.Is(err, lease.ErrNotHeld) {
+			t.Errorf("got error %v, want ErrNotHeld", err)
+		}
+
+		secret, _, err = p.Acquire(ctx, "test", time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fence2, err := p.Fence(ctx, "test", secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fence2 <= fence1 {
+			t.Errorf("second fencing token %d not greater than first %d", fence2, fence1)
+		}
+	})
+}
+
+func TestAcquireWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	withConn(t, func(conn *gozk.Conn, prefix string) {
+		p := New(conn, WithPrefix(prefix))
+
+		secret, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Queue up waiters one at a time,
+		// so their order is known.
+		const n = 3
+		order := make(chan int, n)
+		for i := range n {
+			go func() {
+				secret, _, err := p.AcquireWait(ctx, "test", time.Now().Add(time.Hour))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				order <- i
+				if err := p.Release(ctx, "test", secret); err != nil {
+					t.Error(err)
+				}
+			}()
+			waitForContenders(t, conn, prefix+"/test", i+2)
+		}
+
+		// Non-waiting acquirers do not jump the queue.
+		if _, _, err := p.Acquire(ctx, "test", time.Now().Add(time.Hour)); !errors.Is(err, lease.ErrHeld) {
+			t.Errorf("got error %v, want ErrHeld", err)
+		}
+
+		if err := p.Release(ctx, "test", secret); err != nil {
+			t.Fatal(err)
+		}
+
+		for want := range n {
+			select {
+			case got := <-order:
+				if got != want {
+					t.Errorf("waiter %d acquired the lease in position %d", got, want)
+				}
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		}
+	})
+}
+
+// waitForContenders waits until the lease directory dir has n contenders' znodes.
+func waitForContenders(t *testing.T, conn *gozk.Conn, dir string, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		children, _, err := conn.Children(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(children) >= n {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %d contenders in %s", n, dir)
+}
+
+// withConn calls f with a connection to the ZooKeeper ensemble at ZK_SERVERS
+// (a comma-separated list of host:port addresses)
+// and a fresh znode prefix.
+func withConn(t *testing.T, f func(*gozk.Conn, string)) {
+	servers := os.Getenv("ZK_SERVERS")
+	if servers == "" {
+		t.Skip("ZK_SERVERS must be set")
+	}
+
+	conn, _, err := gozk.Connect(strings.Split(servers, ","), 10*time.Second, gozk.WithLogInfo(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	f(conn, fmt.Sprintf("/lease-test-%d", time.Now().UnixNano()))
+}